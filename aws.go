@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSConfig holds AWS credentials. If they are not given in the config file,
+// they are read from the standard AWS environment variables.
+type AWSConfig struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+}
+
+// AWS metadata endpoints, of the credentials of ECS task roles and of EC2
+// instance roles.
+const (
+	AWSContainerEndpoint = "http://169.254.170.2"
+	AWSInstanceEndpoint  = "http://169.254.169.254"
+)
+
+// AWSMetadataTimeout bounds each request to the AWS metadata endpoints,
+// which do not answer outside AWS.
+const AWSMetadataTimeout = 2 * time.Second
+
+// awsRoleCredentials are the credentials of a role, as given by the AWS
+// metadata endpoints.
+type awsRoleCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// credentials returns the AWS credentials, falling back to the standard AWS
+// credential chain: the environment, the shared credentials file, and the
+// role of the ECS task or the EC2 instance.
+func (c AWSConfig) credentials() (AWSConfig, error) {
+	if c.AccessKeyID != "" || c.SecretAccessKey != "" {
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return c, errors.New("missing AWS access key")
+		}
+
+		return c, nil
+	}
+
+	sources := []func() AWSConfig{envCredentials, sharedCredentials, containerCredentials, instanceCredentials}
+
+	for _, source := range sources {
+		if creds := source(); creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+			return creds, nil
+		}
+	}
+
+	return c, errors.New("missing AWS access key")
+}
+
+// envCredentials returns the AWS credentials in the environment.
+func envCredentials() AWSConfig {
+	return AWSConfig{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// sharedCredentials returns the AWS credentials of the AWS_PROFILE, or the
+// default profile, in the shared credentials file.
+func sharedCredentials() AWSConfig {
+	var creds AWSConfig
+
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return creds
+		}
+
+		file = filepath.Join(homeDir, ".aws", "credentials")
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return creds
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	var section string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+
+		switch value = strings.TrimSpace(value); strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+
+	return creds
+}
+
+// containerCredentials returns the AWS credentials of the role of the ECS
+// task, or of another container credentials provider, if any.
+func containerCredentials() AWSConfig {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		endpoint = AWSContainerEndpoint + uri
+	}
+
+	if endpoint == "" {
+		return AWSConfig{}
+	}
+
+	header := http.Header{}
+
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		content, _ := os.ReadFile(file)
+		token = strings.TrimSpace(string(content))
+	}
+
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+
+	return roleCredentials(endpoint, header)
+}
+
+// instanceCredentials returns the AWS credentials of the role of the EC2
+// instance, if any, with IMDSv2.
+func instanceCredentials() AWSConfig {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return AWSConfig{}
+	}
+
+	token, err := awsMetadata(http.MethodPut, AWSInstanceEndpoint+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"300"}})
+	if err != nil {
+		return AWSConfig{}
+	}
+
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+	credentialsURL := AWSInstanceEndpoint + "/latest/meta-data/iam/security-credentials/"
+
+	role, err := awsMetadata(http.MethodGet, credentialsURL, header)
+	if err != nil || role == "" {
+		return AWSConfig{}
+	}
+
+	// The instance has one role, the first line.
+	role, _, _ = strings.Cut(role, "\n")
+
+	return roleCredentials(credentialsURL+role, header)
+}
+
+// roleCredentials returns the AWS credentials of a role, given by the AWS
+// metadata endpoint url.
+func roleCredentials(url string, header http.Header) AWSConfig {
+	var role awsRoleCredentials
+
+	content, err := awsMetadata(http.MethodGet, url, header)
+	if err != nil || json.Unmarshal([]byte(content), &role) != nil {
+		return AWSConfig{}
+	}
+
+	return AWSConfig{AccessKeyID: role.AccessKeyID, SecretAccessKey: role.SecretAccessKey, SessionToken: role.Token}
+}
+
+// awsMetadata returns the response of an AWS metadata endpoint, which is
+// reached directly, never through a proxy.
+func awsMetadata(method, url string, header http.Header) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), AWSMetadataTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header = header
+
+	client := &http.Client{Transport: &http.Transport{}}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(content))}
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// sha256Hex returns the hex-encoded SHA-256 hash of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// signAWS signs req, whose body is body, with AWS Signature Version 4.
+func signAWS(req *http.Request, body []byte, creds AWSConfig, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Sign the host and all the x-amz-* headers.
+	headers := map[string]string{"host": req.URL.Host}
+
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-amz-") || key == "content-type" {
+			headers[key] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	// AWS wants spaces in the query string encoded as %20, not +.
+	query := strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, query, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenSourceAWS is the "token_source" of a token read from AWS Secrets
+// Manager or SSM Parameter Store, as set in the "aws" section.
+const TokenSourceAWS = "aws"
+
+// AWSSecretConfig is where in AWS the token is kept.
+type AWSSecretConfig struct {
+	AWSConfig
+	// Region is the AWS region of the secret, if not in its ARN, or
+	// AWS_REGION or AWS_DEFAULT_REGION.
+	Region string `json:"region"`
+	// SecretID is the name or ARN of a Secrets Manager secret, and
+	// Parameter that of an SSM parameter, instead.
+	SecretID  string `json:"secret_id"`
+	Parameter string `json:"parameter"`
+	// Field, if set, is the field of the token in a secret of JSON
+	// key/value pairs.
+	Field string `json:"field"`
+}
+
+// region returns the AWS region of the secret.
+func (c AWSSecretConfig) region() string {
+	if c.Region != "" {
+		return c.Region
+	}
+
+	// ARNs are arn:partition:service:region:account:resource.
+	for _, id := range []string{c.SecretID, c.Parameter} {
+		if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+			return parts[3]
+		}
+	}
+
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// awsRequest sends a request of the JSON protocol of AWS APIs, signed with
+// creds, to the target operation of service, and decodes the response into
+// out.
+func awsRequest(ctx context.Context, creds AWSConfig, region, service, target string, body, out interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := "https://" + service + "." + region + ".amazonaws.com/"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	signAWS(req, content, creds, region, service, time.Now())
+
+	resp, err := newAPIClient().Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(content))}
+	}
+
+	return json.Unmarshal(content, out)
+}
+
+// awsSecret returns the token kept in the Secrets Manager secret or the SSM
+// parameter of config.
+func awsSecret(ctx context.Context, config AWSSecretConfig) (string, error) {
+	creds, err := config.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	region := config.region()
+	if region == "" {
+		return "", errors.New("missing AWS region")
+	}
+
+	var secret string
+
+	switch {
+	case config.SecretID != "":
+		var response struct {
+			SecretString string `json:"SecretString"`
+		}
+
+		err = awsRequest(ctx, creds, region, "secretsmanager", "secretsmanager.GetSecretValue",
+			map[string]string{"SecretId": config.SecretID}, &response)
+		if err != nil {
+			return "", fmt.Errorf("error reading the secret %s; %w", config.SecretID, err)
+		}
+
+		secret = response.SecretString
+	case config.Parameter != "":
+		var response struct {
+			Parameter struct {
+				Value string `json:"Value"`
+			} `json:"Parameter"`
+		}
+
+		err = awsRequest(ctx, creds, region, "ssm", "AmazonSSM.GetParameter",
+			map[string]interface{}{"Name": config.Parameter, "WithDecryption": true}, &response)
+		if err != nil {
+			return "", fmt.Errorf("error reading the parameter %s; %w", config.Parameter, err)
+		}
+
+		secret = response.Parameter.Value
+	default:
+		return "", errors.New("missing AWS secret ID or parameter")
+	}
+
+	if config.Field != "" {
+		var fields map[string]interface{}
+
+		if err = json.Unmarshal([]byte(secret), &fields); err != nil {
+			return "", fmt.Errorf("invalid AWS secret, %s", err)
+		}
+
+		secret, _ = fields[config.Field].(string)
+	}
+
+	if secret = strings.TrimSpace(secret); secret == "" {
+		return "", errors.New("empty AWS secret")
+	}
+
+	return secret, nil
+}
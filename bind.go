@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// bindInterface is the network interface that all outbound connections are
+// bound to, if not empty, as set with --bind-interface.
+var bindInterface string
+
+// apiBindAddress is the local address that connections to provider APIs
+// originate from, if not nil, as set with --bind-address.
+var apiBindAddress net.IP
+
+// newDialer returns a dialer for network whose connections originate from
+// bindAddress, if not nil, and from bindInterface, if set.
+func newDialer(network string, bindAddress net.IP) *net.Dialer {
+	dialer := &net.Dialer{}
+
+	if bindAddress != nil {
+		if strings.HasPrefix(network, "udp") {
+			dialer.LocalAddr = &net.UDPAddr{IP: bindAddress}
+		} else {
+			dialer.LocalAddr = &net.TCPAddr{IP: bindAddress}
+		}
+	}
+
+	if bindInterface != "" {
+		dialer.Control = bindToInterface(bindInterface)
+	}
+
+	return dialer
+}
+
+// listenUDP returns a UDP socket for network on bindAddress, if not nil, and
+// on bindInterface, if set.
+func listenUDP(ctx context.Context, network string, bindAddress net.IP) (net.PacketConn, error) {
+	config := net.ListenConfig{}
+	if bindInterface != "" {
+		config.Control = bindToInterface(bindInterface)
+	}
+
+	return config.ListenPacket(ctx, network, (&net.UDPAddr{IP: bindAddress}).String())
+}
+
+// proxyURL is the proxy for outbound HTTP requests, if not nil, as set with
+// "proxy" in the config file. Otherwise HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// apply.
+var proxyURL *url.URL
+
+// proxy returns the proxy for req, or nil if none.
+func proxy(req *http.Request) (*url.URL, error) {
+	if proxyURL != nil {
+		return proxyURL, nil
+	}
+
+	return http.ProxyFromEnvironment(req)
+}
+
+// parseProxy parses the URL of an HTTP, HTTPS or SOCKS5 proxy.
+func parseProxy(text string) (*url.URL, error) {
+	// The URL may have credentials, so it is not in the errors.
+	parsed, err := url.Parse(text)
+	if err != nil || parsed.Host == "" {
+		return nil, errors.New("invalid proxy URL")
+	}
+
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+		return parsed, nil
+	}
+
+	return nil, fmt.Errorf("unsupported proxy scheme, %s", parsed.Scheme)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface returns a socket control function that binds sockets to
+// the network interface name, with IP_BOUND_IF or IPV6_BOUND_IF.
+func bindToInterface(name string) func(string, string, syscall.RawConn) error {
+	return func(network, _ string, conn syscall.RawConn) error {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return err
+		}
+
+		if controlErr := conn.Control(func(fd uintptr) {
+			if strings.HasSuffix(network, "6") {
+				err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, iface.Index)
+			} else {
+				err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, iface.Index)
+			}
+		}); controlErr != nil {
+			return controlErr
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface returns a socket control function that binds sockets to
+// the network interface name, with SO_BINDTODEVICE.
+func bindToInterface(name string) func(string, string, syscall.RawConn) error {
+	return func(_, _ string, conn syscall.RawConn) error {
+		var err error
+
+		if controlErr := conn.Control(func(fd uintptr) {
+			err = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, name)
+		}); controlErr != nil {
+			return controlErr
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CloudflareAPI is the base URL of the Cloudflare API.
+const CloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareConfig is the "cloudflare" section of the config file.
+type CloudflareConfig struct {
+	// Token is an API token with the Zone.DNS edit permission.
+	Token string `json:"token"`
+}
+
+// Cloudflare is the Cloudflare DNS provider.
+type Cloudflare struct {
+	client *http.Client
+	token  string
+	// zones caches zone IDs by domain.
+	zones map[string]string
+}
+
+// cloudflareResponse is the envelope of Cloudflare API responses, besides
+// the result itself.
+type cloudflareResponse struct {
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+// cloudflareRecord is a DNS record in the Cloudflare API.
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content,omitempty"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+	// Data holds the fields of SRV records, instead of Content, and
+	// Priority the priority of MX records, which is not in Content.
+	Data     *cloudflareSRV `json:"data,omitempty"`
+	Priority *int           `json:"priority,omitempty"`
+}
+
+// cloudflareSRV is the data of an SRV record in the Cloudflare API.
+type cloudflareSRV struct {
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+	Target   string `json:"target"`
+}
+
+// newCloudflare returns a Cloudflare provider.
+func newCloudflare(config CloudflareConfig) (*Cloudflare, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing Cloudflare token")
+	}
+
+	return &Cloudflare{client: newAPIClient(), token: config.Token, zones: map[string]string{}}, nil
+}
+
+// request sends a request to the Cloudflare API and decodes the result.
+func (p *Cloudflare) request(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.token)
+
+	err := requestJSON(ctx, p.client, method, CloudflareAPI+path, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check that the Cloudflare token is valid and can edit DNS", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// zoneID returns the ID of the zone for domain.
+func (p *Cloudflare) zoneID(ctx context.Context, domain string) (string, error) {
+	if id, ok := p.zones[domain]; ok {
+		return id, nil
+	}
+
+	var resp struct {
+		cloudflareResponse
+		Result []struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+
+	if err := p.request(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(domain), nil, &resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.Result) == 0 {
+		return "", fmt.Errorf("%w in Cloudflare account: %s", ErrDomainNotFound, domain)
+	}
+
+	p.zones[domain] = resp.Result[0].ID
+
+	return resp.Result[0].ID, nil
+}
+
+// absoluteName returns the fully qualified name of a record in domain.
+func absoluteName(name, domain string) string {
+	if name == "@" || name == "" {
+		return domain
+	}
+
+	return name + "." + domain
+}
+
+// relativeName returns the name of a record relative to domain.
+func relativeName(name, domain string) string {
+	if name == domain {
+		return "@"
+	}
+
+	return strings.TrimSuffix(name, "."+domain)
+}
+
+// Records returns the records in domain with the given type and name.
+func (p *Cloudflare) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("type", recordType)
+	query.Set("name", absoluteName(name, domain))
+	query.Set("per_page", "100")
+
+	var resp struct {
+		cloudflareResponse
+		Result []cloudflareRecord `json:"result"`
+	}
+
+	if err = p.request(ctx, http.MethodGet, "/zones/"+zone+"/dns_records?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(resp.Result))
+
+	for _, record := range resp.Result {
+		data := record.Content
+
+		switch {
+		case record.Type == "SRV" && record.Data != nil:
+			data = joinData([]int{record.Data.Priority, record.Data.Weight, record.Data.Port}, record.Data.Target)
+		case record.Type == "MX" && record.Priority != nil:
+			data = joinData([]int{*record.Priority}, record.Content)
+		}
+
+		records = append(records, DNSRecord{
+			ID:      record.ID,
+			Type:    record.Type,
+			Name:    relativeName(record.Name, domain),
+			Data:    data,
+			TTL:     record.TTL,
+			Proxied: record.Proxied,
+		})
+	}
+
+	return records, nil
+}
+
+// toCloudflare converts a DNSRecord to a Cloudflare record.
+func toCloudflare(record DNSRecord, domain string) cloudflareRecord {
+	ttl := record.TTL
+	if ttl == 0 {
+		// 1 means automatic.
+		ttl = 1
+	}
+
+	converted := cloudflareRecord{
+		Type:    record.Type,
+		Name:    absoluteName(record.Name, domain),
+		Content: record.Data,
+		TTL:     ttl,
+		Proxied: record.Proxied,
+	}
+
+	switch record.Type {
+	case "SRV":
+		numbers, target := dataFields(record.Type, record.Data)
+		converted.Content = ""
+		converted.Data = &cloudflareSRV{Priority: numbers[0], Weight: numbers[1], Port: numbers[2], Target: target}
+	case "MX":
+		numbers, target := dataFields(record.Type, record.Data)
+		converted.Content, converted.Priority = target, &numbers[0]
+	}
+
+	return converted
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *Cloudflare) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return record, err
+	}
+
+	var resp struct {
+		cloudflareResponse
+		Result cloudflareRecord `json:"result"`
+	}
+
+	err = p.request(ctx, http.MethodPost, "/zones/"+zone+"/dns_records", toCloudflare(record, domain), &resp)
+	if err != nil {
+		return record, err
+	}
+
+	record.ID = resp.Result.ID
+	record.TTL = resp.Result.TTL
+
+	return record, nil
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *Cloudflare) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return p.request(ctx, http.MethodPut, "/zones/"+zone+"/dns_records/"+record.ID, toCloudflare(record, domain), nil)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *Cloudflare) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return p.request(ctx, http.MethodDelete, "/zones/"+zone+"/dns_records/"+record.ID, nil, nil)
+}
+
+// Domains returns the names of all the zones in the account.
+func (p *Cloudflare) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for page := 1; ; page++ {
+		var resp struct {
+			cloudflareResponse
+			Result []struct {
+				Name string `json:"name"`
+			} `json:"result"`
+		}
+
+		if err := p.request(ctx, http.MethodGet, fmt.Sprintf("/zones?per_page=50&page=%d", page), nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, zone := range resp.Result {
+			names = append(names, zone.Name)
+		}
+
+		if page >= resp.ResultInfo.TotalPages {
+			return names, nil
+		}
+	}
+}
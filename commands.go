@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Commands, given before the options; without one, the records are set.
+const (
+	// CommandList prints the records of the configured subdomains as they
+	// are at their providers.
+	CommandList = "list"
+	// CommandStatus compares the records as they should be, with the
+	// detected public IP addresses, to those at their providers.
+	CommandStatus = "status"
+	// CommandIP prints the detected public IP addresses.
+	CommandIP = "ip"
+	// CommandDelete deletes the records of the subdomain given on the
+	// command line, or with --all those of the config file.
+	CommandDelete = "delete"
+	// CommandValidate checks the config file.
+	CommandValidate = "validate"
+	// CommandInit writes a new config file, with the settings asked for.
+	CommandInit = "init"
+	// CommandImport prints the config converted from that of another tool.
+	CommandImport = "import"
+	// CommandExport prints the config of the A and AAAA records of a domain.
+	CommandExport = "export"
+	// CommandToken stores the token in the system keyring, or prints it.
+	CommandToken = "token"
+)
+
+// Commands are the known commands.
+var Commands = map[string]bool{
+	CommandList: true, CommandStatus: true, CommandIP: true, CommandDelete: true, CommandValidate: true,
+	CommandInit: true, CommandImport: true, CommandExport: true, CommandToken: true,
+}
+
+// configuredTypes returns the record types to look up for record: both
+// address families for AUTO and dual-stack records.
+func configuredTypes(record Record) []string {
+	recordType := strings.ToUpper(record.Type)
+	if recordType == "AUTO" {
+		recordType = DualStack
+	}
+
+	return recordTypes(recordType)
+}
+
+// printRecords prints the records of providers with the types and names of
+// records, as a table, waiting up to timeout for each provider. It returns
+// the first error found; records after an error are still listed.
+func printRecords(providers Providers, records []Record, timeout time.Duration) error {
+	var firstErr error
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(out, "NAME\tTYPE\tDATA\tTTL\tID")
+
+	zones := Zones{}
+	listed := map[string]bool{}
+
+	for _, record := range records {
+		if _, _, err := record.split(); err != nil {
+			die(err.Error(), nil)
+		}
+
+		provider := providers[record.account()]
+		name, domain := zones.split(provider, record, timeout)
+		fqdn := Record{Name: name, Domain: domain}
+
+		for _, recordType := range configuredTypes(record) {
+			// Records of round-robin sets are listed once.
+			key := record.account() + " " + recordType + " " + strings.ToLower(fqdn.String())
+			if listed[key] {
+				continue
+			}
+
+			listed[key] = true
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			matches, err := provider.Records(ctx, domain, recordType, name)
+
+			cancel()
+
+			if err != nil {
+				writeErr(fmt.Sprintf("%s: error listing %s records for %s; %s", Prog, recordType, fqdn, err))
+
+				if firstErr == nil {
+					firstErr = err
+				}
+
+				continue
+			}
+
+			for _, match := range matches {
+				ttl := "-"
+				if match.TTL > 0 {
+					ttl = strconv.Itoa(match.TTL)
+				}
+
+				_, _ = fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", fqdn, match.Type, match.Data, ttl, match.ID)
+			}
+		}
+	}
+
+	if err := out.Flush(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+// statusEntry is a record as it should be, with all the data of its set.
+type statusEntry struct {
+	record Record
+	want   DNSRecord
+	data   []string
+}
+
+// printStatus detects the public IP addresses like update, and prints
+// whether each record is as it should be at its provider, as a table,
+// without changing any. It returns false if any record is not, or cannot
+// be told, and the first error found.
+func printStatus(providers Providers, config *Config, detection Detection, timeout time.Duration) (bool, error) {
+	var keys []string
+
+	var firstErr error
+
+	inSync := true
+	entries := map[string]*statusEntry{}
+
+	// The wants of records with the same name make up a set, as in
+	// round-robin sets.
+	add := func(records []Record, ips PublicIPs) {
+		for _, record := range records {
+			wants, ok := recordWants(record, ips)
+			inSync = inSync && ok
+
+			for _, want := range wants {
+				key := setKey(Record{Provider: record.account(), Type: want.Type, Subdomain: record.String()})
+
+				entry, found := entries[key]
+				if !found {
+					entry = &statusEntry{record: record, want: want}
+					entries[key] = entry
+					keys = append(keys, key)
+				}
+
+				if dataIndex(want.Type, entry.data, want.Data) < 0 {
+					entry.data = append(entry.data, want.Data)
+				}
+			}
+		}
+	}
+
+	var uplinks []string
+
+	groups := map[string][]Record{}
+
+	for _, record := range config.Records {
+		if StaticTypes[strings.ToUpper(record.Type)] {
+			add([]Record{record}, PublicIPs{})
+
+			continue
+		}
+
+		uplink := record.uplink()
+		if _, ok := groups[uplink]; !ok {
+			uplinks = append(uplinks, uplink)
+		}
+
+		groups[uplink] = append(groups[uplink], record)
+	}
+
+	for _, uplink := range uplinks {
+		records := groups[uplink]
+
+		ips, err := detectPublicIPs(records, detection.forRecord(records[0]), config.Prefer)
+		if err != nil {
+			writeErr(fmt.Sprintf("%s: error getting public IP; %s", Prog, err))
+
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			inSync = false
+
+			continue
+		}
+
+		add(records, ips)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(out, "NAME\tTYPE\tWANTED\tPUBLISHED\tSTATUS")
+
+	zones := Zones{}
+
+	for _, key := range keys {
+		entry := entries[key]
+		provider := providers[entry.record.account()]
+		name, domain := zones.split(provider, entry.record, timeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		matches, err := provider.Records(ctx, domain, entry.want.Type, name)
+
+		cancel()
+
+		status := entry.status(matches)
+		if err != nil {
+			writeErr(fmt.Sprintf("%s: error listing %s records for %s; %s", Prog, entry.want.Type, entry.record, err))
+
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			status = "unknown"
+		}
+
+		inSync = inSync && status == "in sync"
+
+		published := make([]string, 0, len(matches))
+		for _, match := range matches {
+			published = append(published, match.Data)
+		}
+
+		_, _ = fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", entry.record, entry.want.Type,
+			strings.Join(entry.data, ", "), strings.Join(published, ", "), status)
+	}
+
+	if err := out.Flush(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return inSync, firstErr
+}
+
+// status tells whether matches are the records of the entry as they should
+// be: "in sync", "missing" or "out of sync".
+func (entry *statusEntry) status(matches []DNSRecord) string {
+	if len(matches) == 0 {
+		return "missing"
+	}
+
+	found := make([]bool, len(entry.data))
+
+	for _, match := range matches {
+		i := dataIndex(entry.want.Type, entry.data, match.Data)
+		if i < 0 || match.Proxied != entry.want.Proxied || !entry.want.hasTTL(match.TTL) {
+			return "out of sync"
+		}
+
+		found[i] = true
+	}
+
+	for _, ok := range found {
+		if !ok {
+			return "out of sync"
+		}
+	}
+
+	return "in sync"
+}
+
+// detectedIP is a public IP address as printed by the ip command with
+// --json: the address and its source, or why it was not found.
+type detectedIP struct {
+	Address string `json:"address,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// printIP detects the public IP addresses of the families, IPv4 and IPv6
+// unless either is false, and prints them, one for each line, or as JSON
+// along with their sources. Addresses not found are written as errors. It
+// fails if none is found.
+func printIP(detection Detection, ipv4, ipv6 bool, asJSON bool) error {
+	var bind4, bind6 net.IP
+
+	if detection.BindAddress.To4() != nil {
+		bind4 = detection.BindAddress
+	} else {
+		bind6 = detection.BindAddress
+	}
+
+	var lines []string
+
+	families := map[string]bool{"ipv4": ipv4, "ipv6": ipv6}
+	detected := map[string]detectedIP{}
+
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if !families[family] {
+			continue
+		}
+
+		bindAddress, name := bind4, "IPv4"
+		if family == "ipv6" {
+			bindAddress, name = bind6, "IPv6"
+		}
+
+		ip, source, err := detectPublicIPSource(detection, family == "ipv6", bindAddress)
+		if err != nil {
+			detected[family] = detectedIP{Error: err.Error()}
+
+			if !asJSON {
+				writeErr(fmt.Sprintf("%s: no public %s address; %s", Prog, name, err))
+			}
+
+			continue
+		}
+
+		detected[family] = detectedIP{Address: ip.String(), Source: source}
+		lines = append(lines, ip.String())
+	}
+
+	if asJSON {
+		content, err := json.MarshalIndent(detected, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(content))
+	} else {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+
+	if len(lines) == 0 {
+		return errors.New("no public IP address found")
+	}
+
+	return nil
+}
+
+// deleteConfigured deletes the records of providers with the types and
+// names of records, and for records of StaticTypes their data, and
+// remembers them as deleted in policy.State. It returns the first error
+// found; records after an error are still deleted.
+func deleteConfigured(providers Providers, records []Record, policy Policy) error {
+	var firstErr error
+
+	for _, record := range records {
+		if _, _, err := record.split(); err != nil {
+			die(err.Error(), nil)
+		}
+
+		provider := providers[record.account()]
+		name, domain := policy.Zones.split(provider, record, policy.Timeout)
+
+		for _, recordType := range configuredTypes(record) {
+			want := DNSRecord{Type: recordType, Name: name}
+
+			if StaticTypes[recordType] && (record.Data != "" || record.Target != "") {
+				data, err := record.staticData(recordType)
+				if err != nil {
+					die(err.Error(), nil)
+				}
+
+				want.Data = data
+			}
+
+			err := deleteRecord(provider, domain, want, record, policy)
+			if err != nil {
+				writeErr(fmt.Sprintf("%s: error deleting %s record for %s; %s", Prog, recordType, record, err))
+
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+
+			policy.State.publish(stateKey(record.Provider, record, DNSRecord{Type: recordType}), DNSRecord{}, 0, err)
+		}
+	}
+
+	if err := policy.State.save(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error saving state; %w", err)
+	}
+
+	return firstErr
+}
+
+// deleteRecord deletes the records of provider in domain with the type and
+// name of want, and its data if any, set for record.
+func deleteRecord(provider Provider, domain string, want DNSRecord, record Record, policy Policy) error {
+	if updateOnly, ok := provider.(*UpdateOnly); ok {
+		return fmt.Errorf("records cannot be deleted with %s", updateOnly.name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	matches, err := provider.Records(ctx, domain, want.Type, want.Name)
+	if errors.Is(err, ErrDomainNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	deleted := 0
+
+	for _, match := range matches {
+		if want.Data != "" && !sameData(want.Type, match.Data, want.Data) {
+			continue
+		}
+
+		if err = provider.DeleteRecord(ctx, domain, match); err != nil {
+			return err
+		}
+
+		deleted++
+
+		writeOut(fmt.Sprintf("deleted %s %s for %s", want.Type, match.Data, record))
+	}
+
+	if deleted == 0 {
+		writeOut(fmt.Sprintf("no %s record to delete for %s", want.Type, record))
+	}
+
+	return nil
+}
+
+// runValidate writes the problems found in config, read from configFile,
+// and with --online, those found by the providers with their credentials and
+// domains, reached as in a run with the same options. It returns false if
+// any.
+func runValidate(config Config, configFile string, options Options) bool {
+	providers, records, indices, problems := validateConfig(config)
+
+	for i, record := range config.Records {
+		if !record.enabled() {
+			writeErr(fmt.Sprintf("%s: %s: records[%d]: disabled, not checked", Prog, configFile, i))
+		}
+	}
+
+	if options.Online && len(problems) == 0 {
+		if _, err := setNetwork(&config, options); err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			timeout, _ := parseTimeout("api", config.Timeouts.API, APITimeout)
+			problems = checkDomains(providers, records, indices, timeout)
+		}
+	}
+
+	for _, problem := range problems {
+		writeErr(fmt.Sprintf("%s: %s: %s", Prog, configFile, problem))
+	}
+
+	if len(problems) > 0 {
+		return false
+	}
+
+	writeOut(fmt.Sprintf("%s is valid", configFile))
+
+	return true
+}
+
+// exportRecords prints the config of the A and AAAA records of provider in
+// domain, one record for each name, or for each address of a round-robin
+// set, waiting up to timeout for the provider.
+// Only the records with the given names, relative to domain or fully
+// qualified, are exported, or all if none is given.
+func exportRecords(provider Provider, domain string, names []string, timeout time.Duration) error {
+	lister, ok := provider.(ZoneLister)
+	if !ok {
+		return errors.New("the provider can't list the records of a domain")
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	zoneRecords, err := lister.ZoneRecords(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	fqdn := func(name string) string {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name == "@" || name == domain {
+			return domain
+		} else if strings.HasSuffix(name, "."+domain) {
+			return name
+		}
+
+		return name + "." + domain
+	}
+
+	selected := map[string]bool{}
+
+	for _, name := range names {
+		selected[fqdn(name)] = false
+	}
+
+	var subdomains []string
+
+	exported := map[string]map[string][]DNSRecord{}
+
+	for _, record := range zoneRecords {
+		if record.Type != "A" && record.Type != "AAAA" {
+			continue
+		}
+
+		subdomain := fqdn(record.Name)
+		if _, found := selected[subdomain]; !found && len(names) > 0 {
+			continue
+		}
+
+		selected[subdomain] = true
+
+		if exported[subdomain] == nil {
+			subdomains = append(subdomains, subdomain)
+			exported[subdomain] = map[string][]DNSRecord{}
+		}
+
+		exported[subdomain][record.Type] = append(exported[subdomain][record.Type], record)
+	}
+
+	var config importedConfig
+
+	for _, subdomain := range subdomains {
+		ipv4, ipv6 := exported[subdomain]["A"], exported[subdomain]["AAAA"]
+
+		// Records of both families make up one.
+		if len(ipv4) == 1 && len(ipv6) == 1 {
+			config.Records = append(config.Records, configRecord{Type: DualStack, Subdomain: subdomain, TTL: ipv4[0].TTL})
+
+			continue
+		}
+
+		// Members of round-robin sets keep their addresses, so that none is
+		// lost until they get IP sources of their own.
+		for _, family := range [][]DNSRecord{ipv4, ipv6} {
+			for _, record := range family {
+				member := configRecord{Type: record.Type, Subdomain: subdomain, TTL: record.TTL}
+				if len(family) > 1 {
+					member.IP = record.Data
+				}
+
+				config.Records = append(config.Records, member)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !selected[fqdn(name)] {
+			writeErr(fmt.Sprintf("%s: no A or AAAA records for %s", Prog, fqdn(name)))
+		}
+	}
+
+	if len(config.Records) == 0 {
+		return errors.New("no A or AAAA records to export")
+	}
+
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExportRecordsRoundRobin(t *testing.T) {
+	provider := newTestDigitalOcean(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		_, _ = fmt.Fprint(w, `{"domain_records":[`+
+			`{"id":1,"type":"A","name":"www","data":"192.0.2.1","ttl":300},`+
+			`{"id":2,"type":"A","name":"www","data":"192.0.2.2","ttl":300},`+
+			`{"id":3,"type":"AAAA","name":"www","data":"2001:db8::1","ttl":300},`+
+			`{"id":4,"type":"A","name":"vpn","data":"192.0.2.3","ttl":60},`+
+			`{"id":5,"type":"AAAA","name":"vpn","data":"2001:db8::3","ttl":60},`+
+			`{"id":6,"type":"TXT","name":"@","data":"v=spf1 -all","ttl":3600}],`+
+			`"links":{},"meta":{"total":6}}`)
+	})
+
+	var err error
+
+	stdout, _ := captureOutput(t, func() {
+		err = exportRecords(provider, "example.com", nil, time.Second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"records": [
+		{"type": "A", "subdomain": "www.example.com", "ttl": 300, "ip": "192.0.2.1"},
+		{"type": "A", "subdomain": "www.example.com", "ttl": 300, "ip": "192.0.2.2"},
+		{"type": "AAAA", "subdomain": "www.example.com", "ttl": 300},
+		{"type": "A+AAAA", "subdomain": "vpn.example.com", "ttl": 60}
+	]}`
+
+	if !sameJSON(t, []byte(stdout), []byte(want)) {
+		t.Errorf("got %s, want %s", stdout, want)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DDClientConfigFiles are where ddclient looks for its config file, in
+// order.
+var DDClientConfigFiles = []string{"/etc/ddclient/ddclient.conf", "/etc/ddclient.conf"}
+
+// ddclientProviders are the providers of the ddclient protocols that can be
+// imported.
+var ddclientProviders = map[string]string{
+	"digitalocean": ProviderDigitalOcean,
+	"cloudflare":   ProviderCloudflare,
+	"dyndns2":      ProviderDynDNS2,
+	"duckdns":      ProviderDuckDNS,
+	"namecheap":    ProviderNamecheap,
+	"porkbun":      ProviderPorkbun,
+	"gandi":        ProviderGandi,
+}
+
+// ddclientHost is a host of a ddclient config file, with the settings in
+// effect for it.
+type ddclientHost struct {
+	name     string
+	settings map[string]string
+}
+
+// importedConfig is a config file converted from another tool, or exported
+// from a provider, with only the settings used.
+type importedConfig struct {
+	Provider    string            `json:"provider,omitempty"`
+	Token       string            `json:"token,omitempty"`
+	IPSourceURL string            `json:"ip_source_url,omitempty"`
+	Records     []configRecord    `json:"records"`
+	Cloudflare  *CloudflareConfig `json:"cloudflare,omitempty"`
+	Gandi       *GandiConfig      `json:"gandi,omitempty"`
+	Namecheap   *NamecheapConfig  `json:"namecheap,omitempty"`
+	Porkbun     *PorkbunConfig    `json:"porkbun,omitempty"`
+	DynDNS2     *DynDNS2Config    `json:"dyndns2,omitempty"`
+	DuckDNS     *DuckDNSConfig    `json:"duckdns,omitempty"`
+}
+
+// splitDDClient splits a line of a ddclient config file into its words,
+// separated by white space or commas, unless quoted.
+func splitDDClient(line string) []string {
+	var words []string
+
+	var word strings.Builder
+
+	quote := rune(0)
+
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#':
+			// The rest of the line is a comment.
+			if word.Len() > 0 {
+				words = append(words, word.String())
+			}
+
+			return words
+		case c == ',' || c == ' ' || c == '\t':
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(c)
+		}
+	}
+
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// parseDDClient returns the hosts of a ddclient config file. Settings on a
+// line of their own apply to all the hosts after them, and those on the
+// line of hosts only to those hosts.
+func parseDDClient(content string) []ddclientHost {
+	var hosts []ddclientHost
+
+	globals := map[string]string{}
+
+	// Lines ending with a backslash go on in the next line.
+	content = strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\\\n", " ")
+
+	for _, line := range strings.Split(content, "\n") {
+		var names []string
+
+		settings := map[string]string{}
+
+		for _, word := range splitDDClient(line) {
+			if key, value, ok := strings.Cut(word, "="); ok {
+				settings[strings.ToLower(key)] = value
+			} else {
+				names = append(names, word)
+			}
+		}
+
+		if len(names) == 0 {
+			for key, value := range settings {
+				globals[key] = value
+			}
+
+			continue
+		}
+
+		for _, name := range names {
+			host := ddclientHost{name: name, settings: map[string]string{}}
+
+			for key, value := range globals {
+				host.settings[key] = value
+			}
+
+			for key, value := range settings {
+				host.settings[key] = value
+			}
+
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+// recordType returns the type of the record of the host, from the address
+// families it is set for.
+func (host ddclientHost) recordType() string {
+	ipv4 := host.settings["use"] != "" || host.settings["usev4"] != ""
+	ipv6 := host.settings["usev6"] != ""
+
+	switch {
+	case ipv4 && ipv6:
+		return DualStack
+	case ipv6:
+		return "AAAA"
+	}
+
+	return "A"
+}
+
+// importDDClient converts the hosts of a ddclient config file to the config
+// of do-dyndns. Hosts of unsupported protocols are skipped, with a warning.
+func importDDClient(content string) (importedConfig, error) {
+	var config importedConfig
+
+	for _, host := range parseDDClient(content) {
+		settings := host.settings
+		protocol := strings.ToLower(settings["protocol"])
+
+		provider, ok := ddclientProviders[protocol]
+		if !ok {
+			writeErr(fmt.Sprintf("%s: unsupported protocol %q of %s, skipping", Prog, protocol, host.name))
+
+			continue
+		}
+
+		record := configRecord{Type: host.recordType(), Subdomain: host.name}
+
+		// Namecheap hosts may be given relative to the domain, the login.
+		if provider == ProviderNamecheap && !strings.Contains(host.name, ".") {
+			record.Subdomain = host.name + "." + settings["login"]
+			if host.name == "@" {
+				record.Subdomain = settings["login"]
+			}
+		}
+
+		if ttl, err := strconv.Atoi(settings["ttl"]); err == nil && ttl > 0 {
+			record.TTL = ttl
+		}
+
+		// Addresses read from an interface are read per record, and those
+		// from a web service by the config.
+		switch use := strings.ToLower(settings["use"]); {
+		case use == "if" && settings["if"] != "":
+			record.Interface = settings["if"]
+		case settings["usev6"] == "ifv6" && settings["ifv6"] != "":
+			record.Interface = settings["ifv6"]
+		case use == "web" && strings.HasPrefix(settings["web"], "http") && config.IPSourceURL == "":
+			config.IPSourceURL = settings["web"]
+		case use != "" && use != "web":
+			writeErr(fmt.Sprintf("%s: unsupported use=%s of %s, using the default IP sources", Prog, use, host.name))
+		}
+
+		if config.Provider == "" {
+			config.Provider = provider
+		} else if provider != config.Provider {
+			record.Provider = provider
+		}
+
+		// Hosts of other accounts of providers with a token get their own,
+		// and those of providers with more credentials are skipped.
+		token := settings["password"]
+
+		switch provider {
+		case ProviderDigitalOcean:
+			if config.Token == "" {
+				config.Token = token
+			} else if token != config.Token {
+				record.Token = token
+			}
+		case ProviderCloudflare:
+			if config.Cloudflare == nil {
+				config.Cloudflare = &CloudflareConfig{Token: token}
+			} else if token != config.Cloudflare.Token {
+				record.Token = token
+			}
+		case ProviderGandi:
+			if config.Gandi == nil {
+				config.Gandi = &GandiConfig{Token: token}
+			} else if token != config.Gandi.Token {
+				record.Token = token
+			}
+		case ProviderDuckDNS:
+			if config.DuckDNS == nil {
+				config.DuckDNS = &DuckDNSConfig{Token: token}
+			} else if token != config.DuckDNS.Token {
+				record.Token = token
+			}
+		case ProviderPorkbun:
+			porkbun := &PorkbunConfig{APIKey: settings["apikey"], SecretAPIKey: settings["secretapikey"]}
+
+			if config.Porkbun == nil {
+				config.Porkbun = porkbun
+			} else if *porkbun != *config.Porkbun {
+				writeErr(fmt.Sprintf("%s: other %s credentials for %s, not supported, skipping", Prog, provider, host.name))
+
+				continue
+			}
+		case ProviderDynDNS2:
+			dynDNS2 := &DynDNS2Config{Server: settings["server"], Username: settings["login"], Password: token}
+
+			if config.DynDNS2 == nil {
+				config.DynDNS2 = dynDNS2
+			} else if *dynDNS2 != *config.DynDNS2 {
+				writeErr(fmt.Sprintf("%s: other %s credentials for %s, not supported, skipping", Prog, provider, host.name))
+
+				continue
+			}
+		case ProviderNamecheap:
+			if config.Namecheap == nil {
+				config.Namecheap = &NamecheapConfig{Passwords: map[string]string{}}
+			}
+
+			config.Namecheap.Passwords[settings["login"]] = settings["password"]
+		}
+
+		config.Records = append(config.Records, record)
+	}
+
+	if len(config.Records) == 0 {
+		return config, errors.New("no hosts to import")
+	}
+
+	return config, nil
+}
+
+// runImport prints the config converted from the config file of tool, the
+// first of its usual files if file is empty.
+func runImport(tool, file string) error {
+	if tool != "ddclient" {
+		return fmt.Errorf("unknown tool to import from, %s", tool)
+	}
+
+	files := DDClientConfigFiles
+	if file != "" {
+		files = []string{file}
+	}
+
+	var content []byte
+
+	var err error
+
+	for _, path := range files {
+		if content, err = os.ReadFile(path); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	config, err := importDDClient(string(content))
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestImportDDClientCredentials(t *testing.T) {
+	const content = `
+protocol=cloudflare, password=cf-home
+home.example.com
+protocol=cloudflare, password=cf-work
+office.example.org
+protocol=cloudflare, password=cf-home
+nas.example.com
+protocol=porkbun, apikey=pk1_home, secretapikey=sk1_home
+home.example.net
+protocol=porkbun, apikey=pk1_work, secretapikey=sk1_work
+office.example.net
+`
+
+	var (
+		config importedConfig
+		err    error
+	)
+
+	_, stderr := captureOutput(t, func() {
+		config, err = importDDClient(content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+		"provider": "cloudflare",
+		"records": [
+			{"type": "A", "subdomain": "home.example.com"},
+			{"type": "A", "subdomain": "office.example.org", "token": "cf-work"},
+			{"type": "A", "subdomain": "nas.example.com"},
+			{"type": "A", "subdomain": "home.example.net", "provider": "porkbun"}
+		],
+		"cloudflare": {"token": "cf-home"},
+		"porkbun": {"apikey": "pk1_home", "secretapikey": "sk1_home"}
+	}`
+
+	if !sameJSON(t, got, []byte(want)) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if want := "do-dyndns: other porkbun credentials for office.example.net, not supported, skipping\n"; stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DeSECAPI is the base URL of the deSEC API.
+const DeSECAPI = "https://desec.io/api/v1"
+
+// DeSECConfig is the "desec" section of the config file.
+type DeSECConfig struct {
+	Token string `json:"token"`
+}
+
+// DeSEC is the deSEC DNS provider.
+type DeSEC struct {
+	client *http.Client
+	token  string
+	// minTTL caches the minimum TTL of each domain, which also tells that
+	// the domain is in the account.
+	minTTL map[string]int
+}
+
+// deSECRecordSet is an RRset in the deSEC API.
+type deSECRecordSet struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// newDeSEC returns a deSEC DNS provider.
+func newDeSEC(config DeSECConfig) (*DeSEC, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing deSEC token")
+	}
+
+	return &DeSEC{client: newAPIClient(), token: config.Token, minTTL: map[string]int{}}, nil
+}
+
+// request sends a request to the deSEC API and decodes the response.
+func (p *DeSEC) request(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+	header.Set("Authorization", "Token "+p.token)
+
+	err := requestJSON(ctx, p.client, method, DeSECAPI+path, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check that the deSEC token is valid and can write the domain", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// domainMinTTL returns the minimum TTL deSEC allows in domain.
+func (p *DeSEC) domainMinTTL(ctx context.Context, domain string) (int, error) {
+	if ttl, ok := p.minTTL[domain]; ok {
+		return ttl, nil
+	}
+
+	var resp struct {
+		MinimumTTL int `json:"minimum_ttl"`
+	}
+
+	err := p.request(ctx, http.MethodGet, "/domains/"+url.PathEscape(domain)+"/", nil, &resp)
+	if isNotFound(err) {
+		return 0, fmt.Errorf("%w in deSEC account: %s", ErrDomainNotFound, domain)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	p.minTTL[domain] = resp.MinimumTTL
+
+	return resp.MinimumTTL, nil
+}
+
+// recordSet returns the RRset with the given type and name in domain.
+// It has no records if there is none.
+func (p *DeSEC) recordSet(ctx context.Context, domain, recordType, name string) (deSECRecordSet, error) {
+	set := deSECRecordSet{Subname: blankApex(name), Type: recordType}
+
+	if _, err := p.domainMinTTL(ctx, domain); err != nil {
+		return set, err
+	}
+
+	// The apex RRsets are at the "@" subname.
+	path := "/domains/" + url.PathEscape(domain) + "/rrsets/" + url.PathEscape(name) + "/" + recordType + "/"
+
+	if err := p.request(ctx, http.MethodGet, path, nil, &set); err != nil && !isNotFound(err) {
+		return set, err
+	}
+
+	return set, nil
+}
+
+// patch writes an RRset to domain, creating it if needed; an RRset with no
+// records is deleted. TTLs below the domain minimum are raised to it.
+func (p *DeSEC) patch(ctx context.Context, domain string, set deSECRecordSet) (int, error) {
+	minTTL, err := p.domainMinTTL(ctx, domain)
+	if err != nil {
+		return 0, err
+	}
+
+	if set.TTL < minTTL {
+		set.TTL = minTTL
+	}
+
+	// The bulk endpoint creates the RRset if it doesn't exist yet.
+	return set.TTL, p.request(ctx, http.MethodPatch, "/domains/"+url.PathEscape(domain)+"/rrsets/",
+		[]deSECRecordSet{set}, nil)
+}
+
+// Records returns the records in domain with the given type and name.
+// deSEC groups records with the same name and type in an RRset; each value
+// is returned as a separate record, with the value itself as its ID.
+func (p *DeSEC) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	set, err := p.recordSet(ctx, domain, recordType, name)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(set.Records))
+
+	for _, value := range set.Records {
+		records = append(records, DNSRecord{
+			ID: value, Type: recordType, Name: name, Data: parseZoneData(recordType, value), TTL: set.TTL,
+		})
+	}
+
+	return records, nil
+}
+
+// CreateRecord adds a record to its RRset in domain, creating the RRset if
+// needed, and returns it as created.
+func (p *DeSEC) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	ttl, err := p.replaceValue(ctx, domain, record, "")
+	if err != nil {
+		return record, err
+	}
+
+	record.ID = zoneData(record.Type, record.Data)
+	record.TTL = ttl
+
+	return record, nil
+}
+
+// UpdateRecord replaces the value of an existing record in domain.
+func (p *DeSEC) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	_, err := p.replaceValue(ctx, domain, record, record.ID)
+
+	return err
+}
+
+// replaceValue patches the RRset of record, replacing the value old with
+// the record data; if old is empty, the data is added to the RRset.
+// It returns the TTL of the RRset.
+func (p *DeSEC) replaceValue(ctx context.Context, domain string, record DNSRecord, old string) (int, error) {
+	set, err := p.recordSet(ctx, domain, record.Type, record.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	data := zoneData(record.Type, record.Data)
+	values := []string{data}
+
+	for _, value := range set.Records {
+		if value != old && value != data {
+			values = append(values, value)
+		}
+	}
+
+	set.Records = values
+
+	if record.TTL > 0 {
+		set.TTL = record.TTL
+	}
+
+	return p.patch(ctx, domain, set)
+}
+
+// DeleteRecord removes a record from its RRset in domain, deleting the
+// RRset if it was its last value.
+func (p *DeSEC) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	set, err := p.recordSet(ctx, domain, record.Type, record.Name)
+	if err != nil {
+		return err
+	}
+
+	values := []string{}
+
+	for _, value := range set.Records {
+		if value != record.ID {
+			values = append(values, value)
+		}
+	}
+
+	set.Records = values
+	_, err = p.patch(ctx, domain, set)
+
+	return err
+}
+
+// Domains returns the names of all the domains in the account.
+func (p *DeSEC) Domains(ctx context.Context) ([]string, error) {
+	var resp []struct {
+		Name string `json:"name"`
+	}
+
+	if err := p.request(ctx, http.MethodGet, "/domains/", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(resp))
+
+	for _, domain := range resp {
+		names = append(names, domain.Name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,920 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Detector finds out the public IP address of the machine.
+type Detector interface {
+	// Detect returns the public IPv4 or IPv6 address of the machine.
+	// If bindAddress is not nil, detection originates from it.
+	Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error)
+	// String returns the name of the detector, for error messages.
+	String() string
+}
+
+// PrefixDetector is a Detector that can also tell the IPv6 prefix delegated
+// to the network, e.g. a router, whose own address may be outside of it.
+type PrefixDetector interface {
+	Detector
+	// DetectPrefix returns the delegated IPv6 prefix, with its length.
+	DetectPrefix(ctx context.Context, bindAddress net.IP) (*net.IPNet, error)
+}
+
+// Response formats of web detection services.
+const (
+	// FormatText is just the address in plain text.
+	FormatText = "text"
+	// FormatJSON is a JSON object with the address in a field.
+	FormatJSON = "json"
+	// FormatTrace is one "key=value" pair per line, as in the Cloudflare
+	// trace, with the address in one of them.
+	FormatTrace = "trace"
+)
+
+// WebDetector asks a web service for the address that the machine connects
+// from.
+type WebDetector struct {
+	// URL4 and URL6 are the service URLs for each address family; a
+	// dual-stack service can use the same URL for both. An empty URL means
+	// the family is not supported.
+	URL4 string
+	URL6 string
+	// Format is the format of the response, FormatText if empty.
+	Format string
+	// Field is where the address is in a FormatJSON response, as a path
+	// with dots between keys, e.g. "data.ip", or the key of the address in
+	// a FormatTrace response.
+	Field string
+}
+
+// DetectorCatalogue are the built-in public IP address detectors, by name.
+var DetectorCatalogue = map[string]Detector{
+	"ipify":       WebDetector{URL4: "https://api4.ipify.org", URL6: "https://api6.ipify.org"},
+	"icanhazip":   WebDetector{URL4: "https://ipv4.icanhazip.com", URL6: "https://ipv6.icanhazip.com"},
+	"ident.me":    WebDetector{URL4: "https://v4.ident.me", URL6: "https://v6.ident.me"},
+	"ifconfig.me": WebDetector{URL4: "https://ifconfig.me/ip", URL6: "https://ifconfig.me/ip"},
+	"ifconfig.co": WebDetector{
+		URL4: "https://ifconfig.co/json", URL6: "https://ifconfig.co/json", Format: FormatJSON, Field: "ip",
+	},
+	// Amazon has no IPv6 service.
+	"amazon": WebDetector{URL4: "https://checkip.amazonaws.com"},
+	"cloudflare": WebDetector{
+		URL4:   "https://1.1.1.1/cdn-cgi/trace",
+		URL6:   "https://[2606:4700:4700::1111]/cdn-cgi/trace",
+		Format: FormatTrace,
+		Field:  "ip",
+	},
+	// resolver1.opendns.com answers with the address asking for this name.
+	"opendns": DNSDetector{
+		Name: "myip.opendns.com.", Type: "A", Server4: "208.67.222.222", Server6: "2620:119:35::35",
+	},
+	// ns1.google.com answers with the address asking for this TXT record.
+	"google": DNSDetector{
+		Name: "o-o.myaddr.l.google.com.", Type: "TXT", Server4: "216.239.32.10", Server6: "2001:4860:4802:32::a",
+	},
+	"stun": STUNDetector{Server: "stun.l.google.com:19302"},
+	// The local gateway, with no external service.
+	"natpmp":   NATPMPDetector{},
+	"upnp":     UPnPDetector{},
+	"fritzbox": FritzBoxDetector{},
+}
+
+// DetectorFactories make detectors from IP sources given as "kind:argument",
+// e.g. "stun:stun.example.com:3478", by kind.
+var DetectorFactories = map[string]func(string) Detector{
+	// Any STUN server, as host:port.
+	"stun": func(server string) Detector { return STUNDetector{Server: server} },
+	// A NAT-PMP gateway other than the default one.
+	"natpmp": func(gateway string) Detector { return NATPMPDetector{Gateway: gateway} },
+	// A FRITZ!Box other than fritz.box.
+	"fritzbox": func(host string) Detector { return FritzBoxDetector{Host: host} },
+}
+
+// ConfiguredDetectors make detectors set up in their own section of the
+// config file, by name.
+var ConfiguredDetectors = map[string]func(*Config) (Detector, error){
+	"mikrotik": func(config *Config) (Detector, error) { return newMikroTikDetector(config.MikroTik) },
+	"opnsense": func(config *Config) (Detector, error) { return newOPNsenseDetector(config.OPNsense) },
+	"pfsense":  func(config *Config) (Detector, error) { return newPfSenseDetector(config.PfSense) },
+}
+
+// DefaultDetectors are the names of the detectors used unless the config
+// file says otherwise.
+var DefaultDetectors = []string{"ipify", "icanhazip", "ident.me"}
+
+// DetectTimeout is how long to wait for each detector, unless set otherwise
+// in the config file.
+const DetectTimeout = 10 * time.Second
+
+// createIPClient returns an HTTP client that connects only over network,
+// "tcp4" or "tcp6". If bindAddress is not nil, connections originate from
+// that local address.
+func createIPClient(network string, bindAddress net.IP) *http.Client {
+	dialer := newDialer(network, bindAddress)
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// createIPv4Client returns an HTTP client that connects only over IPv4.
+func createIPv4Client(bindAddress net.IP) *http.Client {
+	return createIPClient("tcp4", bindAddress)
+}
+
+// createIPv6Client returns an HTTP client that connects only over IPv6.
+func createIPv6Client(bindAddress net.IP) *http.Client {
+	return createIPClient("tcp6", bindAddress)
+}
+
+// myPublicIP returns the public IP address of the machine, as reported by
+// the detection service at url, in the given response format and field.
+func myPublicIP(ctx context.Context, client *http.Client, url, format, field string) (ip net.IP, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(body)
+
+	switch format {
+	case FormatJSON:
+		text, err = jsonField(body, field)
+	case FormatTrace:
+		text, err = traceField(text, field)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ip = net.ParseIP(strings.TrimSpace(text))
+	if ip == nil {
+		err = errors.New("no IP address found")
+	}
+
+	return ip, err
+}
+
+// jsonField returns the string at path in a JSON document, with dots
+// between object keys or array indices.
+func jsonField(content []byte, path string) (string, error) {
+	var value interface{}
+
+	if err := json.Unmarshal(content, &value); err != nil {
+		return "", err
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("no %s field in response", path)
+			}
+
+			value = v[i]
+		default:
+			return "", fmt.Errorf("no %s field in response", path)
+		}
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("no %s field in response", path)
+	}
+
+	return text, nil
+}
+
+// traceField returns the value of key in a FormatTrace response.
+func traceField(content, key string) (string, error) {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, key+"=") {
+			return strings.TrimPrefix(line, key+"="), nil
+		}
+	}
+
+	return "", fmt.Errorf("no %s field in response", key)
+}
+
+// Detect returns the public IP address reported by the web service.
+func (d WebDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	client, url := createIPv4Client(bindAddress), d.URL4
+	if ipv6 {
+		client, url = createIPv6Client(bindAddress), d.URL6
+	}
+
+	if url == "" {
+		return nil, errors.New("address family not supported")
+	}
+
+	return myPublicIP(ctx, client, url, d.Format, d.Field)
+}
+
+// String returns the URL of the web service.
+func (d WebDetector) String() string {
+	if d.URL4 == "" {
+		return d.URL6
+	}
+
+	return d.URL4
+}
+
+// newDetectors returns the detectors set up in config: the custom service,
+// if any, followed by the named ones. Without either, DefaultDetectors are
+// used.
+func newDetectors(config *Config) ([]Detector, error) {
+	var detectors []Detector
+
+	if config.IPSourceURL != "" {
+		custom := WebDetector{URL4: config.IPSourceURL, URL6: config.IPSourceURL}
+		if config.IPSourceField != "" {
+			custom.Format, custom.Field = FormatJSON, config.IPSourceField
+		}
+
+		detectors = append(detectors, custom)
+	}
+
+	names := config.IPSources
+	if len(names) == 0 && len(detectors) == 0 {
+		names = DefaultDetectors
+	}
+
+	for _, name := range names {
+		if kind, arg, ok := strings.Cut(name, ":"); ok && DetectorFactories[kind] != nil {
+			detectors = append(detectors, DetectorFactories[kind](arg))
+
+			continue
+		}
+
+		if configured, ok := ConfiguredDetectors[name]; ok {
+			detector, err := configured(config)
+			if err != nil {
+				return nil, err
+			}
+
+			detectors = append(detectors, detector)
+
+			continue
+		}
+
+		detector, ok := DetectorCatalogue[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown IP source, %s", name)
+		}
+
+		detectors = append(detectors, detector)
+	}
+
+	return detectors, nil
+}
+
+// CGNATRange is the shared address space of carrier-grade NAT, RFC 6598.
+var CGNATRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// SpecialRanges are the other special-use networks, as in RFC 6890 and its
+// updates, that addresses on the internet are never in, and what they are.
+var SpecialRanges = []struct {
+	Network *net.IPNet
+	Reason  string
+}{
+	{parseCIDR("0.0.0.0/8"), `a "this network" address (RFC 1122)`},
+	{parseCIDR("192.0.2.0/24"), "a documentation address (RFC 5737)"},
+	{parseCIDR("198.51.100.0/24"), "a documentation address (RFC 5737)"},
+	{parseCIDR("203.0.113.0/24"), "a documentation address (RFC 5737)"},
+	{parseCIDR("198.18.0.0/15"), "a benchmarking address (RFC 2544)"},
+	{parseCIDR("240.0.0.0/4"), "a reserved address (RFC 1112)"},
+	{parseCIDR("2001:db8::/32"), "a documentation address (RFC 3849)"},
+	{parseCIDR("2001:2::/48"), "a benchmarking address (RFC 5180)"},
+	{parseCIDR("100::/64"), "a discard-only address (RFC 6666)"},
+	{parseCIDR("64:ff9b:1::/48"), "a local-use NAT64 address (RFC 8215)"},
+}
+
+// parseCIDR returns the network of cidr, which must be valid.
+func parseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	return network
+}
+
+// nonPublicReason returns why ip cannot be reached from the internet, or an
+// empty string if it is a public address.
+func nonPublicReason(ip net.IP) string {
+	switch {
+	case ip.IsUnspecified():
+		return "the unspecified address"
+	case ip.IsLoopback():
+		return "a loopback address"
+	case ip.IsLinkLocalUnicast():
+		return "a link-local address"
+	case ip.IsPrivate() && ip.To4() != nil:
+		return "a private address (RFC 1918)"
+	case ip.IsPrivate():
+		return "a unique local address (RFC 4193)"
+	case CGNATRange.Contains(ip):
+		return "a carrier-grade NAT address (RFC 6598) of the ISP"
+	case !ip.IsGlobalUnicast():
+		return "a multicast or broadcast address"
+	}
+
+	for _, special := range SpecialRanges {
+		if special.Network.Contains(ip) {
+			return special.Reason
+		}
+	}
+
+	return ""
+}
+
+// isPublic returns whether ip can be reached from the internet.
+func isPublic(ip net.IP) bool {
+	return nonPublicReason(ip) == ""
+}
+
+// checkAddress returns an error unless ip is of the given family, and is a
+// public address unless allowPrivate. IPv6 detection services may otherwise
+// report, for example, an IPv4 address through a NAT64 gateway.
+func checkAddress(ip net.IP, ipv6, allowPrivate bool) error {
+	if ipv6 && ip.To4() != nil {
+		return fmt.Errorf("%s is not an IPv6 address", ip)
+	} else if !ipv6 && ip.To4() == nil {
+		return fmt.Errorf("%s is not an IPv4 address", ip)
+	}
+
+	if reason := nonPublicReason(ip); reason != "" && !allowPrivate {
+		return fmt.Errorf("%s is %s, which cannot be reached from the internet", ip, reason)
+	}
+
+	return nil
+}
+
+// StaticDetector returns given addresses, for publishing an address known
+// beforehand instead of detecting it.
+type StaticDetector struct {
+	// IPs are the addresses, at most one per family.
+	IPs []net.IP
+}
+
+// newStaticDetector returns a detector of the addresses in text, separated
+// by white space, at most one per family.
+func newStaticDetector(text string) (StaticDetector, error) {
+	ips, err := parseIPs(text)
+	if err != nil {
+		return StaticDetector{}, err
+	}
+
+	if len(ips) == 0 {
+		return StaticDetector{}, errors.New("no IP address given")
+	}
+
+	if len(ips) > 2 || (len(ips) == 2 && (ips[0].To4() == nil) == (ips[1].To4() == nil)) {
+		return StaticDetector{}, errors.New("more than one IP address of the same family given")
+	}
+
+	return StaticDetector{IPs: ips}, nil
+}
+
+// Detect returns the given address in the family.
+func (d StaticDetector) Detect(_ context.Context, ipv6 bool, _ net.IP) (net.IP, error) {
+	for _, ip := range d.IPs {
+		if (ip.To4() == nil) == ipv6 {
+			return ip, nil
+		}
+	}
+
+	if ipv6 {
+		return nil, errors.New("no IPv6 address given")
+	}
+
+	return nil, errors.New("no IPv4 address given")
+}
+
+// String returns the name of the detector.
+func (StaticDetector) String() string {
+	return "given address"
+}
+
+// FileDetector reads the address from a file written by other tools, e.g.
+// DHCP client hooks or pppd ip-up scripts. The file is read every time, so
+// a daemon always sees the latest address.
+type FileDetector struct {
+	Path string
+}
+
+// parseIPs returns the IP addresses in text, separated by white space.
+func parseIPs(text string) ([]net.IP, error) {
+	var ips []net.IP
+
+	for _, field := range strings.Fields(text) {
+		ip := net.ParseIP(field)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address, %s", field)
+		}
+
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// Detect returns the first address in the file in the family.
+func (d FileDetector) Detect(_ context.Context, ipv6 bool, _ net.IP) (net.IP, error) {
+	content, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := parseIPs(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	return StaticDetector{IPs: ips}.Detect(context.Background(), ipv6, nil)
+}
+
+// String returns the file.
+func (d FileDetector) String() string {
+	return d.Path
+}
+
+// detectPublicIP returns the public IPv4 or IPv6 address of the machine,
+// as found by detection. If bindAddress is not nil, detection originates
+// from it. All detectors are tried again as set in detection.Retry.
+func detectPublicIP(detection Detection, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	ip, _, err := detectPublicIPSource(detection, ipv6, bindAddress)
+
+	return ip, err
+}
+
+// detectPublicIPSource is like detectPublicIP, and also returns the source
+// of the address: the detector that found it, or those that agreed on it.
+func detectPublicIPSource(detection Detection, ipv6 bool, bindAddress net.IP) (ip net.IP, source string, err error) {
+	// Given addresses won't change on a retry.
+	retry := detection.Retry
+	if detection.Given {
+		retry.Retries = 0
+	}
+
+	err = retry.do(func() error {
+		if detection.Consensus > 1 {
+			ip, source, err = detection.consensus(ipv6, bindAddress)
+		} else {
+			ip, source, err = detection.first(ipv6, bindAddress)
+		}
+
+		return err
+	})
+
+	return ip, source, err
+}
+
+// detectWith returns the address found by detector within the detection
+// timeout.
+func (detection Detection) detectWith(detector Detector, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), detection.Timeout)
+	defer cancel()
+
+	ip, err := detector.Detect(ctx, ipv6, bindAddress)
+	if err == nil {
+		err = checkAddress(ip, ipv6, detection.AllowPrivate)
+	}
+
+	if err == nil {
+		err = detection.checkRanges(ip)
+	}
+
+	return ip, err
+}
+
+// checkRanges returns an error if ip is outside the allowed ranges of its
+// family; if there are none for the family, any address is allowed.
+func (detection Detection) checkRanges(ip net.IP) error {
+	found := false
+
+	for _, allowed := range detection.AllowedRanges {
+		if (allowed.IP.To4() == nil) != (ip.To4() == nil) {
+			continue
+		}
+
+		if allowed.Contains(ip) {
+			return nil
+		}
+
+		found = true
+	}
+
+	if found {
+		return fmt.Errorf("%s is outside the allowed ranges", ip)
+	}
+
+	return nil
+}
+
+// first returns the address from the first detector that answers, and the
+// detector.
+func (detection Detection) first(ipv6 bool, bindAddress net.IP) (net.IP, string, error) {
+	failures := make([]string, 0, len(detection.Detectors))
+
+	for _, detector := range detection.Detectors {
+		ip, err := detection.detectWith(detector, ipv6, bindAddress)
+		if err == nil {
+			return ip, fmt.Sprint(detector), nil
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %s", detector, err))
+	}
+
+	return nil, "", errors.New(strings.Join(failures, "; "))
+}
+
+// consensus asks all detectors at once, and returns the address reported by
+// at least Consensus of them, so that a single misbehaving service cannot
+// publish a bogus address, and the detectors that agreed.
+func (detection Detection) consensus(ipv6 bool, bindAddress net.IP) (net.IP, string, error) {
+	detectors, quorum := detection.Detectors, detection.Consensus
+	ips := make([]net.IP, len(detectors))
+	errs := make([]error, len(detectors))
+
+	var wg sync.WaitGroup
+
+	for i, detector := range detectors {
+		wg.Add(1)
+
+		go func(i int, detector Detector) {
+			defer wg.Done()
+
+			ips[i], errs[i] = detection.detectWith(detector, ipv6, bindAddress)
+		}(i, detector)
+	}
+
+	wg.Wait()
+
+	votes := map[string][]string{}
+	answers := make([]string, 0, len(detectors))
+
+	for i, detector := range detectors {
+		if errs[i] != nil {
+			answers = append(answers, fmt.Sprintf("%s: %s", detector, errs[i]))
+
+			continue
+		}
+
+		ip := ips[i].String()
+
+		votes[ip] = append(votes[ip], fmt.Sprint(detector))
+		if len(votes[ip]) >= quorum {
+			return ips[i], strings.Join(votes[ip], ", "), nil
+		}
+
+		answers = append(answers, fmt.Sprintf("%s: %s", detector, ips[i]))
+	}
+
+	return nil, "", fmt.Errorf("fewer than %d detectors agree: %s", quorum, strings.Join(answers, "; "))
+}
+
+// PublicIPs are the public IP addresses of the machine; either can be nil.
+type PublicIPs struct {
+	IPv4 net.IP
+	IPv6 net.IP
+	// IPv6Prefix, if not nil, is the IPv6 prefix delegated to the network,
+	// as told by a PrefixDetector, which suffixes are combined with.
+	IPv6Prefix *net.IPNet
+	// ErrIPv4 and ErrIPv6 are the reasons why an address is nil.
+	ErrIPv4 error
+	ErrIPv6 error
+	// Prefer is the address family used for AUTO records when both are available.
+	Prefer string
+}
+
+// Address family preferences, for AUTO records.
+const (
+	PreferIPv4 = "ipv4"
+	PreferIPv6 = "ipv6"
+)
+
+// DualStack is the record type for setting both A and AAAA records.
+const DualStack = "A+AAAA"
+
+// recordTypes returns the actual record types to set for a record type.
+func recordTypes(recordType string) []string {
+	if recordType == DualStack {
+		return []string{"A", "AAAA"}
+	}
+
+	return []string{recordType}
+}
+
+// forType returns the IP address for a record type; for AUTO, it also
+// returns the actual record type chosen. The address is nil if not available.
+// The error explains why the address is nil, if so.
+func (ips PublicIPs) forType(recordType string) (string, net.IP, error) {
+	switch recordType {
+	case "A":
+		return recordType, ips.IPv4, ips.ErrIPv4
+	case "AAAA":
+		return recordType, ips.IPv6, ips.ErrIPv6
+	}
+
+	if ips.IPv6 != nil && (ips.IPv4 == nil || ips.Prefer == PreferIPv6) {
+		return "AAAA", ips.IPv6, nil
+	}
+
+	return "A", ips.IPv4, ips.ErrIPv4
+}
+
+// DefaultPrefixLength is the length of the network prefix of IPv6 addresses
+// combined with a suffix.
+const DefaultPrefixLength = 64
+
+// withSuffix returns the IPv6 address made of the first prefixLength bits of
+// ip, DefaultPrefixLength if 0, followed by the rest of suffix.
+func withSuffix(ip net.IP, suffix string, prefixLength int) (net.IP, error) {
+	host := net.ParseIP(suffix)
+	if host == nil || host.To4() != nil {
+		return nil, fmt.Errorf("invalid IPv6 suffix, %s", suffix)
+	}
+
+	if prefixLength == 0 {
+		prefixLength = DefaultPrefixLength
+	}
+
+	if prefixLength < 0 || prefixLength > 128 {
+		return nil, fmt.Errorf("invalid prefix length, %d", prefixLength)
+	}
+
+	mask := net.CIDRMask(prefixLength, 128)
+	combined := make(net.IP, net.IPv6len)
+
+	for i := range combined {
+		combined[i] = ip.To16()[i]&mask[i] | host[i]&^mask[i]
+	}
+
+	return combined, nil
+}
+
+// Detection is how public IP addresses are detected.
+type Detection struct {
+	Detectors []Detector
+	// Consensus, if more than 1, is how many detectors must report the same
+	// address; all detectors are then asked at once.
+	Consensus int
+	// AllowPrivate allows publishing private and other non-public addresses.
+	AllowPrivate bool
+	// AllowedRanges, if any, are the only networks that addresses can be
+	// published from, per family.
+	AllowedRanges []*net.IPNet
+	// Given is whether the addresses are given rather than detected, and
+	// so used for records bound to uplinks too.
+	Given bool
+	// BindAddress, if not nil, is the local address that detection for its
+	// family originates from.
+	BindAddress net.IP
+	// Sources are the detectors of the records with IP sources of their
+	// own, by Record.ipSource.
+	Sources map[string][]Detector
+	// Timeout is how long to wait for each detector.
+	Timeout time.Duration
+	// Retry is how to retry when no detector finds the address.
+	Retry Retry
+}
+
+// newDetection returns the public IP address detection set up in config.
+// Detection originates from bindAddress, if not nil.
+func newDetection(config *Config, bindAddress net.IP) (Detection, error) {
+	detection := Detection{Consensus: config.IPConsensus, AllowPrivate: config.AllowPrivate, BindAddress: bindAddress}
+
+	timeout, err := parseTimeout("detect", config.Timeouts.Detect, DetectTimeout)
+	if err != nil {
+		return detection, err
+	}
+
+	detection.Timeout = timeout
+
+	if detection.Retry, err = newRetry("detect", config.DetectRetry); err != nil {
+		return detection, err
+	}
+
+	for _, cidr := range config.AllowedRanges {
+		_, allowed, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return detection, fmt.Errorf("invalid allowed range, %s", cidr)
+		}
+
+		detection.AllowedRanges = append(detection.AllowedRanges, allowed)
+	}
+
+	for _, record := range config.Records {
+		if record.BindAddress != "" && net.ParseIP(record.BindAddress) == nil {
+			return detection, fmt.Errorf("invalid bind address of %s, %s", record, record.BindAddress)
+		}
+	}
+
+	if detection.Sources, err = newRecordSources(config); err != nil {
+		return detection, err
+	}
+
+	// An interface with a public address needs no other detector.
+	if config.Interface != "" {
+		detection.Detectors = []Detector{InterfaceDetector{Name: config.Interface}}
+		detection.Consensus = 0
+
+		return detection, nil
+	}
+
+	detectors, err := newDetectors(config)
+	if err != nil {
+		return detection, err
+	}
+
+	if config.IPConsensus > len(detectors) {
+		return detection, fmt.Errorf("IP consensus of %d needs as many IP sources, only %d configured",
+			config.IPConsensus, len(detectors))
+	}
+
+	detection.Detectors = detectors
+
+	return detection, nil
+}
+
+// newRecordSources returns the detectors of the records in config with IP
+// sources of their own, by Record.ipSource.
+func newRecordSources(config *Config) (map[string][]Detector, error) {
+	sources := map[string][]Detector{}
+
+	for _, record := range config.Records {
+		source := record.ipSource()
+		if _, ok := sources[source]; ok || source == "" {
+			continue
+		}
+
+		if record.IP != "" {
+			static, err := newStaticDetector(record.IP)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address of %s, %s", record, err)
+			}
+
+			sources[source] = []Detector{static}
+
+			continue
+		}
+
+		// Named detectors may be set up in the config, e.g. routers.
+		own := *config
+		own.IPSourceURL, own.IPSourceField, own.IPSources = record.IPSourceURL, record.IPSourceField, record.IPSources
+
+		detectors, err := newDetectors(&own)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP source of %s, %w", record, err)
+		}
+
+		sources[source] = detectors
+	}
+
+	return sources, nil
+}
+
+// forRecord returns the detection for the uplink that record is bound to,
+// and its own IP sources, or detection itself if none. The IP sources of a
+// record are tried in order, without consensus.
+func (detection Detection) forRecord(record Record) Detection {
+	if record.AllowPrivate != nil {
+		detection.AllowPrivate = *record.AllowPrivate
+	}
+
+	switch {
+	case detection.Given:
+		return detection
+	case record.Interface != "":
+		detection.Detectors, detection.Consensus = []Detector{InterfaceDetector{Name: record.Interface}}, 0
+
+		return detection
+	case record.ipSource() != "":
+		detection.Detectors, detection.Consensus = detection.Sources[record.ipSource()], 0
+		detection.Given = record.IP != ""
+	}
+
+	if record.BindAddress != "" {
+		detection.BindAddress = net.ParseIP(record.BindAddress)
+	}
+
+	return detection
+}
+
+// detectPrefix returns the IPv6 prefix delegated to the network, from the
+// first detector that tells it, or nil if none does.
+func (detection Detection) detectPrefix(bindAddress net.IP) *net.IPNet {
+	for _, detector := range detection.Detectors {
+		prefixDetector, ok := detector.(PrefixDetector)
+		if !ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), detection.Timeout)
+		prefix, err := prefixDetector.DetectPrefix(ctx, bindAddress)
+
+		cancel()
+
+		if err == nil {
+			return prefix
+		}
+
+		writeErr(fmt.Sprintf("%s: %s: error getting the IPv6 prefix; %s", Prog, detector, err))
+	}
+
+	return nil
+}
+
+// detectPublicIPs detects the public IP addresses needed by records, each
+// family independently. A family that is not available keeps its error in
+// ips, and only the records that need it are skipped when set; it fails
+// only if no address at all is available.
+func detectPublicIPs(records []Record, detection Detection, prefer string) (ips PublicIPs, err error) {
+	var needIPv4, needIPv6, suffix bool
+
+	for _, record := range records {
+		suffix = suffix || record.IPv6Suffix != ""
+
+		switch strings.ToUpper(record.Type) {
+		case "A":
+			needIPv4 = true
+		case "AAAA":
+			needIPv6 = true
+		case "AUTO", DualStack:
+			needIPv4, needIPv6 = true, true
+		}
+	}
+
+	ips.Prefer = prefer
+
+	var bind4, bind6 net.IP
+
+	if detection.BindAddress.To4() != nil {
+		bind4 = detection.BindAddress
+	} else {
+		bind6 = detection.BindAddress
+	}
+
+	if needIPv4 {
+		ips.IPv4, ips.ErrIPv4 = detectPublicIP(detection, false, bind4)
+	}
+
+	if needIPv6 {
+		ips.IPv6, ips.ErrIPv6 = detectPublicIP(detection, true, bind6)
+
+		if suffix && ips.IPv6 != nil && !detection.Given {
+			ips.IPv6Prefix = detection.detectPrefix(bind6)
+		}
+	}
+
+	switch {
+	case ips.IPv4 != nil || ips.IPv6 != nil:
+		return ips, nil
+	case needIPv4 && needIPv6:
+		return ips, fmt.Errorf("IPv4: %v; IPv6: %w", ips.ErrIPv4, ips.ErrIPv6)
+	case needIPv4:
+		return ips, fmt.Errorf("IPv4: %w", ips.ErrIPv4)
+	}
+
+	return ips, fmt.Errorf("IPv6: %w", ips.ErrIPv6)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectPublicIPsFamilies(t *testing.T) {
+	tests := []struct {
+		name    string
+		given   string
+		records []Record
+		ipv4    string
+		ipv6    string
+		err     string
+	}{
+		{
+			name:    "no IPv6 uplink",
+			given:   "198.51.100.7",
+			records: []Record{{Type: "A", Subdomain: "home.example.com"}, {Type: "AAAA", Subdomain: "nas.example.com"}},
+			ipv4:    "198.51.100.7",
+		},
+		{
+			name:    "no IPv4 uplink",
+			given:   "2001:db8::7",
+			records: []Record{{Type: "A", Subdomain: "home.example.com"}, {Type: "AAAA", Subdomain: "nas.example.com"}},
+			ipv6:    "2001:db8::7",
+		},
+		{
+			name:    "no address",
+			given:   "2001:db8::7",
+			records: []Record{{Type: "A", Subdomain: "home.example.com"}},
+			err:     "IPv4: ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			static, err := newStaticDetector(test.given)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			detection := Detection{Detectors: []Detector{static}, AllowPrivate: true, Given: true, Timeout: time.Second}
+
+			ips, err := detectPublicIPs(test.records, detection, "")
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ipv4, ipv6 := fmt.Sprint(ips.IPv4), fmt.Sprint(ips.IPv6); ipv4 != orNil(test.ipv4) ||
+				ipv6 != orNil(test.ipv6) {
+				t.Errorf("got %s and %s, want %s and %s", ipv4, ipv6, orNil(test.ipv4), orNil(test.ipv6))
+			}
+
+			// Only the records of the missing family are skipped.
+			var set []string
+
+			_, stderr := captureOutput(t, func() {
+				for _, record := range test.records {
+					if wants, ok := recordWants(record, ips); ok {
+						set = append(set, wants[0].Type+" "+wants[0].Data)
+					}
+				}
+			})
+
+			if len(set) != 1 || stderr == "" {
+				t.Errorf("got %q set and stderr %q, want one record set and the other skipped", set, stderr)
+			}
+		})
+	}
+}
+
+// orNil returns ip, or how a nil address prints if empty.
+func orNil(ip string) string {
+	if ip == "" {
+		return "<nil>"
+	}
+
+	return ip
+}
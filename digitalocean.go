@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// DigitalOcean is the DigitalOcean DNS provider.
+type DigitalOcean struct {
+	client *godo.Client
+}
+
+// newDigitalOcean returns a DigitalOcean provider authenticated with token.
+func newDigitalOcean(token string) (*DigitalOcean, error) {
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+
+	client := newAPIClient()
+	client.Transport = tokenTransport{token: strings.Trim(strings.TrimSpace(token), "'"), base: client.Transport}
+
+	return &DigitalOcean{client: godo.NewClient(client)}, nil
+}
+
+// tokenTransport authenticates requests to the DigitalOcean API with a
+// token.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+// RoundTrip sends req with the token.
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	return t.base.RoundTrip(req)
+}
+
+// apiError translates DigitalOcean API failures into friendlier errors.
+func apiError(resp *godo.Response, err error) error {
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w, check that the token is valid and has Write scope", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// fromGodo converts a godo record to a DNSRecord.
+// DigitalOcean keeps the numbers of SRV and MX records apart from their
+// target.
+func fromGodo(record godo.DomainRecord) DNSRecord {
+	data := record.Data
+
+	switch record.Type {
+	case "SRV":
+		data = joinData([]int{record.Priority, record.Weight, record.Port}, record.Data)
+	case "MX":
+		data = joinData([]int{record.Priority}, record.Data)
+	}
+
+	return DNSRecord{
+		ID:   strconv.Itoa(record.ID),
+		Type: record.Type,
+		Name: record.Name,
+		Data: data,
+		TTL:  record.TTL,
+	}
+}
+
+// editRequest converts a DNSRecord to a godo edit request.
+func editRequest(record DNSRecord) *godo.DomainRecordEditRequest {
+	request := &godo.DomainRecordEditRequest{
+		Type: record.Type,
+		Name: record.Name,
+		Data: absoluteData(record.Type, record.Data),
+		TTL:  record.TTL,
+	}
+
+	switch record.Type {
+	case "SRV":
+		numbers, target := dataFields(record.Type, record.Data)
+		request.Priority, request.Weight, request.Port = numbers[0], numbers[1], numbers[2]
+		request.Data = absoluteData(record.Type, target)
+	case "MX":
+		numbers, target := dataFields(record.Type, record.Data)
+		request.Priority = numbers[0]
+		request.Data = absoluteData(record.Type, target)
+	}
+
+	return request
+}
+
+// Records returns the records in domain with the given type and name.
+// The API is asked for just those records, unless it can't filter them and
+// all the records are listed instead.
+func (p *DigitalOcean) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	// Records are filtered by their fully qualified name.
+	fqdn := name + "." + domain
+	if name == "@" {
+		fqdn = domain
+	}
+
+	matches, resp, err := listRecords(recordType, name,
+		func(opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+			return p.client.Domains.RecordsByTypeAndName(ctx, domain, recordType, fqdn, opt)
+		})
+	if err != nil && resp != nil &&
+		(resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotImplemented) {
+		matches, resp, err = listRecords(recordType, name,
+			func(opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+				return p.client.Domains.Records(ctx, domain, opt)
+			})
+	}
+
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w in DigitalOcean account: %s", ErrDomainNotFound, domain)
+		}
+
+		return nil, apiError(resp, err)
+	}
+
+	return matches, nil
+}
+
+// ZoneRecords returns all the records in domain.
+func (p *DigitalOcean) ZoneRecords(ctx context.Context, domain string) ([]DNSRecord, error) {
+	records, resp, err := pageRecords(func(godo.DomainRecord) bool { return true },
+		func(opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+			return p.client.Domains.Records(ctx, domain, opt)
+		})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w in DigitalOcean account: %s", ErrDomainNotFound, domain)
+		}
+
+		return nil, apiError(resp, err)
+	}
+
+	return records, nil
+}
+
+// listRecords returns the records with the given type and name from all the
+// pages that list returns, and the response of the last page.
+// Records are matched here too, in case the API didn't filter them.
+func listRecords(
+	recordType, name string, list func(*godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error),
+) ([]DNSRecord, *godo.Response, error) {
+	return pageRecords(func(record godo.DomainRecord) bool {
+		return record.Type == recordType && record.Name == name
+	}, list)
+}
+
+// pageRecords returns the records that match from all the pages that list
+// returns, and the response of the last page.
+func pageRecords(
+	match func(godo.DomainRecord) bool, list func(*godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error),
+) ([]DNSRecord, *godo.Response, error) {
+	var matches []DNSRecord
+
+	opt := &godo.ListOptions{PerPage: 200}
+
+	for {
+		records, resp, err := list(opt)
+		if err != nil {
+			return nil, resp, err
+		}
+
+		for _, record := range records {
+			if match(record) {
+				matches = append(matches, fromGodo(record))
+			}
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return matches, resp, nil
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, resp, err
+		}
+
+		opt.Page = page + 1
+	}
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *DigitalOcean) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	created, resp, err := p.client.Domains.CreateRecord(ctx, domain, editRequest(record))
+	if err != nil {
+		return record, apiError(resp, err)
+	}
+
+	return fromGodo(*created), nil
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *DigitalOcean) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	id, err := strconv.Atoi(record.ID)
+	if err != nil {
+		return err
+	}
+
+	_, resp, err := p.client.Domains.EditRecord(ctx, domain, id, editRequest(record))
+
+	return apiError(resp, err)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *DigitalOcean) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	id, err := strconv.Atoi(record.ID)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Domains.DeleteRecord(ctx, domain, id)
+
+	return apiError(resp, err)
+}
+
+// Domains returns the names of all the domains managed by the account.
+func (p *DigitalOcean) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	opt := &godo.ListOptions{PerPage: 200}
+
+	for {
+		domains, resp, err := p.client.Domains.List(ctx, opt)
+		if err != nil {
+			return nil, apiError(resp, err)
+		}
+
+		for _, domain := range domains {
+			names = append(names, domain.Name)
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return names, nil
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+
+		opt.Page = page + 1
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// newTestDigitalOcean returns a DigitalOcean provider whose API is served by
+// handler.
+func newTestDigitalOcean(t *testing.T, handler http.HandlerFunc) *DigitalOcean {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := godo.NewClient(server.Client())
+
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.BaseURL = baseURL
+
+	return &DigitalOcean{client: client}
+}
+
+// captureOutput returns what f writes to stdout and stderr, with messages
+// sent to them.
+func captureOutput(t *testing.T, f func()) (string, string) {
+	t.Helper()
+
+	read := func(file **os.File) func() string {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		saved := *file
+		*file = writer
+
+		done := make(chan string)
+
+		go func() {
+			var buf bytes.Buffer
+
+			_, _ = io.Copy(&buf, reader)
+			done <- buf.String()
+		}()
+
+		return func() string {
+			*file = saved
+			_ = writer.Close()
+
+			return <-done
+		}
+	}
+
+	savedTarget := logTarget
+	logTarget = LogTargetStdout
+
+	defer func() {
+		logTarget = savedTarget
+	}()
+
+	stdout, stderr := read(&os.Stdout), read(&os.Stderr)
+
+	f()
+
+	return stdout(), stderr()
+}
+
+func notFound(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+
+	_, _ = fmt.Fprint(w, `{"id":"not_found","message":"The resource you were accessing could not be found."}`)
+}
+
+func TestRecordsDomainNotFound(t *testing.T) {
+	provider := newTestDigitalOcean(t, notFound)
+
+	_, err := provider.Records(context.Background(), "example.com", "A", "home")
+	if !errors.Is(err, ErrDomainNotFound) {
+		t.Fatalf("got error %v, want ErrDomainNotFound", err)
+	}
+
+	if want := "domain not found in DigitalOcean account: example.com"; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+}
+
+func TestSetRecordDomainNotFound(t *testing.T) {
+	providers := Providers{ProviderDigitalOcean: newTestDigitalOcean(t, notFound)}
+	record := Record{Type: "A", Subdomain: "home.example.com", Provider: ProviderDigitalOcean}
+
+	var (
+		ok  bool
+		err error
+	)
+
+	stdout, stderr := captureOutput(t, func() {
+		ok, _, err = setRecord(providers, record, DNSRecord{Type: "A", Data: "198.51.100.7"},
+			Policy{Timeout: time.Second}, setSubdomainIP)
+	})
+
+	// The record is skipped, but the run goes on.
+	if ok || err != nil {
+		t.Errorf("got %t, %v; want false, no error", ok, err)
+	}
+
+	want := "do-dyndns: domain not found in DigitalOcean account: example.com, skipping home.example.com\n"
+	if stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+
+	if stdout != "" {
+		t.Errorf("got stdout %q, want none", stdout)
+	}
+}
+
+func TestSetSubdomainIPDuplicates(t *testing.T) {
+	tests := []struct {
+		duplicates string
+		calls      []string
+		stdout     string
+		stderr     string
+	}{
+		{
+			duplicates: DuplicatesWarn,
+			calls:      []string{"GET A home.example.com", "PUT 1 198.51.100.7"},
+			stderr:     "do-dyndns: found 2 A records for home.example.com, setting only the first\n",
+		},
+		{
+			duplicates: DuplicatesUpdate,
+			calls:      []string{"GET A home.example.com", "PUT 1 198.51.100.7", "PUT 2 198.51.100.7"},
+		},
+		{
+			duplicates: DuplicatesDelete,
+			calls:      []string{"GET A home.example.com", "DELETE 2", "PUT 1 198.51.100.7"},
+			stdout:     "deleted duplicate A 192.0.2.2 for home.example.com\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.duplicates, func(t *testing.T) {
+			var calls []string
+
+			provider := newTestDigitalOcean(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+
+				switch r.Method {
+				case http.MethodGet:
+					query := r.URL.Query()
+					calls = append(calls, "GET "+query.Get("type")+" "+query.Get("name"))
+
+					_, _ = fmt.Fprint(w, `{"domain_records":[`+
+						`{"id":1,"type":"A","name":"home","data":"192.0.2.1","ttl":1800},`+
+						`{"id":2,"type":"A","name":"home","data":"192.0.2.2","ttl":1800}],`+
+						`"links":{},"meta":{"total":2}}`)
+				case http.MethodPut:
+					var request godo.DomainRecordEditRequest
+					if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+						t.Error(err)
+					}
+
+					calls = append(calls, "PUT "+path.Base(r.URL.Path)+" "+request.Data)
+
+					_, _ = fmt.Fprintf(w, `{"domain_record":{"id":%s,"type":"A","name":"home","data":%q}}`,
+						path.Base(r.URL.Path), request.Data)
+				case http.MethodDelete:
+					calls = append(calls, "DELETE "+path.Base(r.URL.Path))
+
+					w.WriteHeader(http.StatusNoContent)
+				}
+			})
+
+			policy := Policy{Duplicates: test.duplicates, Timeout: time.Second}
+
+			stdout, stderr := captureOutput(t, func() {
+				want := DNSRecord{Type: "A", Name: "home", Data: "198.51.100.7"}
+
+				if _, _, err := setSubdomainIP(provider, "example.com", want, policy); err != nil {
+					t.Error(err)
+				}
+			})
+
+			if strings.Join(calls, "; ") != strings.Join(test.calls, "; ") {
+				t.Errorf("got calls %q, want %q", calls, test.calls)
+			}
+
+			if stdout != test.stdout {
+				t.Errorf("got stdout %q, want %q", stdout, test.stdout)
+			}
+
+			if stderr != test.stderr {
+				t.Errorf("got stderr %q, want %q", stderr, test.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DynDNS2Server is the default server of the DynDNS2 update protocol.
+const DynDNS2Server = "members.dyndns.org"
+
+// DuckDNSURL is the DuckDNS update URL.
+const DuckDNSURL = "https://www.duckdns.org/update"
+
+// DynDNS2Config is the "dyndns2" section of the config file.
+type DynDNS2Config struct {
+	// Server is the host name of the update server, or a full update URL.
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DuckDNSConfig is the "duckdns" section of the config file.
+type DuckDNSConfig struct {
+	Token string `json:"token"`
+}
+
+// DynDNS2 is a client of the DynDNS2 update protocol, also used by No-IP,
+// Dynu and many others.
+type DynDNS2 struct {
+	client *http.Client
+	url    string
+	config DynDNS2Config
+}
+
+// DuckDNS is the DuckDNS client.
+type DuckDNS struct {
+	client *http.Client
+	token  string
+}
+
+// dynDNS2Errors explains the DynDNS2 error return codes.
+var dynDNS2Errors = map[string]string{
+	"badauth":  "bad username or password",
+	"badagent": "the client was blocked",
+	"notfqdn":  "the hostname is not a fully qualified domain name",
+	"nohost":   "the hostname does not exist in the account",
+	"numhost":  "too many hosts in one update",
+	"abuse":    "the hostname was blocked for abuse",
+	"dnserr":   "DNS error on the server",
+	"911":      "the server is down for maintenance",
+}
+
+// newDynDNS2 returns a DynDNS2 update protocol provider.
+func newDynDNS2(config DynDNS2Config) (*UpdateOnly, error) {
+	if config.Username == "" || config.Password == "" {
+		return nil, errors.New("missing DynDNS2 username or password")
+	}
+
+	if config.Server == "" {
+		config.Server = DynDNS2Server
+	}
+
+	target := config.Server
+	if !strings.Contains(target, "://") {
+		target = "https://" + target + "/nic/update"
+	}
+
+	client := &DynDNS2{client: newAPIClient(), url: target, config: config}
+
+	return newUpdateOnly("the DynDNS2 protocol", client.update), nil
+}
+
+// newDuckDNS returns a DuckDNS provider.
+func newDuckDNS(config DuckDNSConfig) (*UpdateOnly, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing DuckDNS token")
+	}
+
+	client := &DuckDNS{client: newAPIClient(), token: config.Token}
+
+	return newUpdateOnly("DuckDNS", client.update), nil
+}
+
+// getUpdate sends a GET request to an update URL, with basic authentication
+// unless username is empty, and returns the response text.
+func getUpdate(ctx context.Context, client *http.Client, target, username, password string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+
+	// DynDNS2 servers block clients without a proper user agent.
+	req.Header.Set("User-Agent", Prog+"/"+Version)
+
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	text := string(bytes.TrimSpace(content))
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w, check the username and password", ErrUnauthorized)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: text}
+	}
+
+	return text, nil
+}
+
+// update sets the address of a record in domain.
+func (p *DynDNS2) update(ctx context.Context, domain string, record DNSRecord) error {
+	query := url.Values{}
+	query.Set("hostname", absoluteName(record.Name, domain))
+
+	switch record.Type {
+	case "A":
+		query.Set("myip", record.Data)
+	case "AAAA":
+		query.Set("myipv6", record.Data)
+	default:
+		return fmt.Errorf("only A and AAAA records can be set with the DynDNS2 protocol, not %s", record.Type)
+	}
+
+	text, err := getUpdate(ctx, p.client, p.url+"?"+query.Encode(), p.config.Username, p.config.Password)
+	if err != nil {
+		return err
+	}
+
+	code := strings.Fields(text + " ")[0]
+
+	switch code {
+	case "good", "nochg":
+		return nil
+	case "badauth":
+		return fmt.Errorf("%w, %s", ErrUnauthorized, dynDNS2Errors[code])
+	case "nohost":
+		return fmt.Errorf("%w in DynDNS2 account: %s", ErrDomainNotFound, absoluteName(record.Name, domain))
+	}
+
+	if reason, ok := dynDNS2Errors[code]; ok {
+		return fmt.Errorf("update rejected by %s, %s", p.config.Server, reason)
+	}
+
+	return fmt.Errorf("update rejected by %s, %q", p.config.Server, text)
+}
+
+// update sets the address, or the text of a TXT record, of a record in
+// domain, which must be duckdns.org.
+func (p *DuckDNS) update(ctx context.Context, domain string, record DNSRecord) error {
+	if domain != "duckdns.org" {
+		return fmt.Errorf("%w in DuckDNS: %s", ErrDomainNotFound, domain)
+	}
+
+	query := url.Values{}
+	query.Set("domains", record.Name)
+	query.Set("token", p.token)
+
+	switch record.Type {
+	case "A":
+		query.Set("ip", record.Data)
+	case "AAAA":
+		query.Set("ipv6", record.Data)
+	case "TXT":
+		query.Set("txt", record.Data)
+	default:
+		return fmt.Errorf("only A, AAAA and TXT records can be set with DuckDNS, not %s", record.Type)
+	}
+
+	text, err := getUpdate(ctx, p.client, DuckDNSURL+"?"+query.Encode(), "", "")
+	if err != nil {
+		return err
+	}
+
+	// DuckDNS doesn't tell why an update failed.
+	if text != "OK" {
+		return errors.New("update rejected by DuckDNS, check the token and subdomain")
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IdentityFileEnv is the age identity file that decrypts the config file,
+// as with --identity.
+const IdentityFileEnv = "DYNDNS_IDENTITY_FILE"
+
+// DecryptTimeout bounds the decryption of the config file, which may wait
+// for the passphrase of the identity on the terminal.
+const DecryptTimeout = 2 * time.Minute
+
+// ageHeaders begin the files encrypted with age, binary or armored.
+var ageHeaders = [][]byte{[]byte("age-encryption.org/"), []byte("-----BEGIN AGE ENCRYPTED FILE-----")}
+
+// sopsMetadata matches the metadata of files encrypted with sops, JSON or
+// YAML, with the MAC of the values.
+var sopsMetadata = regexp.MustCompile(`(?m)^sops:|"sops"\s*:\s*\{`)
+
+// encryptedFormat returns the format of the config file content, "age" or
+// "sops" if encrypted with either, or else empty.
+func encryptedFormat(content []byte) string {
+	trimmed := bytes.TrimSpace(content)
+
+	for _, header := range ageHeaders {
+		if bytes.HasPrefix(trimmed, header) {
+			return "age"
+		}
+	}
+
+	if sopsMetadata.Match(content) && bytes.Contains(content, []byte("ENC[AES256_GCM,")) {
+		return "sops"
+	}
+
+	return ""
+}
+
+// decryptConfig returns the content of the config file configFile decrypted
+// with age or sops, in memory, and the name of the file it was encrypted
+// from, which tells its format. identity is the age identity file, the
+// default of sops if empty.
+func decryptConfig(content []byte, configFile, identity string) ([]byte, string, error) {
+	name := configFile
+
+	ctx, cancel := context.WithTimeout(context.Background(), DecryptTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+
+	switch encryptedFormat(content) {
+	case "age":
+		if identity == "" {
+			return nil, name, fmt.Errorf("missing age identity file to decrypt %s", configFile)
+		}
+
+		cmd = exec.CommandContext(ctx, "age", "--decrypt", "--identity", identity)
+		name = strings.TrimSuffix(configFile, ".age")
+	case "sops":
+		format := "json"
+		if ext := strings.ToLower(filepath.Ext(configFile)); ext == ".yaml" || ext == ".yml" {
+			format = "yaml"
+		}
+
+		cmd = exec.CommandContext(ctx, "sops", "--decrypt", "--input-type", format, "--output-type", format,
+			"/dev/stdin")
+
+		if identity != "" {
+			cmd.Env = append(os.Environ(), "SOPS_AGE_KEY_FILE="+identity)
+		}
+	default:
+		return content, name, nil
+	}
+
+	// The identity may ask for a passphrase, on the terminal.
+	cmd.Stdin, cmd.Stderr = bytes.NewReader(content), os.Stderr
+
+	output, err := cmd.Output()
+
+	var execErr *exec.Error
+	if errors.As(err, &execErr) {
+		return nil, name, fmt.Errorf("%s is encrypted, but %s is not installed", configFile, cmd.Args[0])
+	} else if err != nil {
+		return nil, name, fmt.Errorf("error decrypting %s; %w", configFile, err)
+	}
+
+	return output, name, nil
+}
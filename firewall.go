@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// OPNsenseConfig is the "opnsense" section of the config file.
+type OPNsenseConfig struct {
+	// URL is the base URL of the firewall web interface.
+	URL    string `json:"url"`
+	Key    string `json:"key"`
+	Secret string `json:"secret"`
+	// Interface is the device of the WAN interface, e.g. "igb0" or "pppoe0".
+	Interface string `json:"interface"`
+}
+
+// PfSenseConfig is the "pfsense" section of the config file.
+type PfSenseConfig struct {
+	// URL is the base URL of the firewall web interface.
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+	// Interface is the name of the WAN interface, "wan" by default.
+	Interface string `json:"interface"`
+}
+
+// OPNsenseDetector asks an OPNsense firewall, with its API, for the address
+// of its WAN interface.
+type OPNsenseDetector struct {
+	config OPNsenseConfig
+}
+
+// PfSenseDetector asks a pfSense firewall, with the REST API package, for
+// the address of its WAN interface.
+type PfSenseDetector struct {
+	config PfSenseConfig
+}
+
+// newOPNsenseDetector returns an OPNsense detector.
+func newOPNsenseDetector(config OPNsenseConfig) (OPNsenseDetector, error) {
+	if config.URL == "" || config.Key == "" || config.Secret == "" || config.Interface == "" {
+		return OPNsenseDetector{}, errors.New("missing OPNsense URL, key, secret or interface")
+	}
+
+	config.URL = strings.TrimSuffix(config.URL, "/")
+
+	return OPNsenseDetector{config: config}, nil
+}
+
+// newPfSenseDetector returns a pfSense detector.
+func newPfSenseDetector(config PfSenseConfig) (PfSenseDetector, error) {
+	if config.URL == "" || config.APIKey == "" {
+		return PfSenseDetector{}, errors.New("missing pfSense URL or API key")
+	}
+
+	if config.Interface == "" {
+		config.Interface = "wan"
+	}
+
+	config.URL = strings.TrimSuffix(config.URL, "/")
+
+	return PfSenseDetector{config: config}, nil
+}
+
+// Detect returns the first public address of the WAN interface.
+func (d OPNsenseDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(d.config.Key+":"+d.config.Secret)))
+
+	type address struct {
+		IPAddr string `json:"ipaddr"`
+	}
+
+	var interfaces map[string]struct {
+		IPv4 []address `json:"ipv4"`
+		IPv6 []address `json:"ipv6"`
+	}
+
+	err := deviceRequest(ctx, "OPNsense", d.config.URL+"/api/diagnostics/interface/getInterfaceConfig", header,
+		bindAddress, &interfaces)
+	if err != nil {
+		return nil, err
+	}
+
+	iface, ok := interfaces[d.config.Interface]
+	if !ok {
+		return nil, fmt.Errorf("no interface %s in OPNsense", d.config.Interface)
+	}
+
+	addresses := iface.IPv4
+	if ipv6 {
+		addresses = iface.IPv6
+	}
+
+	for _, address := range addresses {
+		if ip := net.ParseIP(address.IPAddr); ip != nil && isPublic(ip) {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no public address on interface %s", d.config.Interface)
+}
+
+// String returns the firewall asked.
+func (d OPNsenseDetector) String() string {
+	return "OPNsense at " + d.config.URL
+}
+
+// Detect returns the address of the WAN interface.
+func (d PfSenseDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	header := http.Header{}
+	header.Set("X-API-Key", d.config.APIKey)
+
+	var resp struct {
+		Data []struct {
+			Name     string `json:"name"`
+			Descr    string `json:"descr"`
+			IPAddr   string `json:"ipaddr"`
+			IPAddrV6 string `json:"ipaddrv6"`
+		} `json:"data"`
+	}
+
+	err := deviceRequest(ctx, "pfSense", d.config.URL+"/api/v2/status/interfaces", header, bindAddress, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iface := range resp.Data {
+		if iface.Name != d.config.Interface && !strings.EqualFold(iface.Descr, d.config.Interface) {
+			continue
+		}
+
+		address := iface.IPAddr
+		if ipv6 {
+			address = iface.IPAddrV6
+		}
+
+		if ip := net.ParseIP(address); ip != nil && isPublic(ip) {
+			return ip, nil
+		}
+
+		return nil, fmt.Errorf("no public address on interface %s", d.config.Interface)
+	}
+
+	return nil, fmt.Errorf("no interface %s in pfSense", d.config.Interface)
+}
+
+// String returns the firewall asked.
+func (d PfSenseDetector) String() string {
+	return "pfSense at " + d.config.URL
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// FritzBoxHost is the default host name of an AVM FRITZ!Box.
+const FritzBoxHost = "fritz.box"
+
+// FritzBoxService is the WAN connection service of the FRITZ!Box, which
+// answers over UPnP/TR-064 without authentication.
+const FritzBoxService = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+// FritzBoxDetector asks an AVM FRITZ!Box router for its WAN addresses. It
+// is fast, accurate and needs no external service.
+type FritzBoxDetector struct {
+	// Host is the address or host name of the FRITZ!Box, FritzBoxHost if
+	// empty.
+	Host string
+}
+
+// target returns the control URL of the WAN connection service.
+func (d FritzBoxDetector) target() string {
+	host := d.Host
+	if host == "" {
+		host = FritzBoxHost
+	}
+
+	return "http://" + net.JoinHostPort(host, "49000") + "/igdupnp/control/WANIPConn1"
+}
+
+// Detect returns the external IPv4 or IPv6 address of the FRITZ!Box.
+func (d FritzBoxDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	action := "GetExternalIPAddress"
+	if ipv6 {
+		action = "X_AVM_DE_GetExternalIPv6Address"
+	}
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				IPv4 string `xml:"NewExternalIPAddress"`
+				IPv6 string `xml:"NewExternalIPv6Address"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+
+	err := soapRequest(ctx, newLANClient(bindAddress), d.target(), FritzBoxService, action, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	address := envelope.Body.Response.IPv4
+	if ipv6 {
+		address = envelope.Body.Response.IPv6
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return nil, errors.New("the FRITZ!Box has no external address")
+	}
+
+	return ip, nil
+}
+
+// DetectPrefix returns the IPv6 prefix that the ISP delegated to the
+// FRITZ!Box, which the addresses of its LAN are in, unlike its own WAN
+// address.
+func (d FritzBoxDetector) DetectPrefix(ctx context.Context, bindAddress net.IP) (*net.IPNet, error) {
+	var envelope struct {
+		Body struct {
+			Response struct {
+				Prefix string `xml:"NewIPv6Prefix"`
+				Length int    `xml:"NewPrefixLength"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+
+	err := soapRequest(ctx, newLANClient(bindAddress), d.target(), FritzBoxService, "X_AVM_DE_GetIPv6Prefix",
+		&envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	response := envelope.Body.Response
+
+	prefix := net.ParseIP(strings.TrimSpace(response.Prefix))
+	if prefix == nil || prefix.To4() != nil || response.Length <= 0 || response.Length > 128 {
+		return nil, errors.New("the FRITZ!Box has no IPv6 prefix")
+	}
+
+	mask := net.CIDRMask(response.Length, 128)
+
+	return &net.IPNet{IP: prefix.Mask(mask), Mask: mask}, nil
+}
+
+// String returns the FRITZ!Box asked.
+func (d FritzBoxDetector) String() string {
+	if d.Host == "" {
+		return "FRITZ!Box at " + FritzBoxHost
+	}
+
+	return "FRITZ!Box at " + d.Host
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GandiAPI is the base URL of the Gandi LiveDNS API.
+const GandiAPI = "https://api.gandi.net/v5/livedns"
+
+// GandiTTL is the TTL of new Gandi records, the minimum LiveDNS allows.
+const GandiTTL = 300
+
+// GandiConfig is the "gandi" section of the config file.
+type GandiConfig struct {
+	// Token is a personal access token with the "Manage domain name
+	// technical configurations" permission.
+	Token string `json:"token"`
+}
+
+// Gandi is the Gandi LiveDNS provider.
+type Gandi struct {
+	client *http.Client
+	token  string
+	// domains caches the domains known to be in the account.
+	domains map[string]bool
+}
+
+// gandiRecordSet is a resource record set in the LiveDNS API.
+type gandiRecordSet struct {
+	Values []string `json:"rrset_values"`
+	TTL    int      `json:"rrset_ttl,omitempty"`
+}
+
+// newGandi returns a Gandi LiveDNS provider.
+func newGandi(config GandiConfig) (*Gandi, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing Gandi token")
+	}
+
+	return &Gandi{client: newAPIClient(), token: config.Token, domains: map[string]bool{}}, nil
+}
+
+// request sends a request to the LiveDNS API and decodes the response.
+func (p *Gandi) request(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.token)
+
+	err := requestJSON(ctx, p.client, method, GandiAPI+path, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check that the Gandi token is valid and can manage the domain", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// recordSetPath returns the API path of a record set in domain.
+func (p *Gandi) recordSetPath(ctx context.Context, domain, recordType, name string) (string, error) {
+	if !p.domains[domain] {
+		err := p.request(ctx, http.MethodGet, "/domains/"+url.PathEscape(domain), nil, nil)
+		if isNotFound(err) {
+			return "", fmt.Errorf("%w in Gandi account: %s", ErrDomainNotFound, domain)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		p.domains[domain] = true
+	}
+
+	return "/domains/" + url.PathEscape(domain) + "/records/" + url.PathEscape(name) + "/" + recordType, nil
+}
+
+// recordSet returns the record set with the given type and name in domain.
+// It is empty if there is none.
+func (p *Gandi) recordSet(ctx context.Context, domain, recordType, name string) (string, gandiRecordSet, error) {
+	var set gandiRecordSet
+
+	path, err := p.recordSetPath(ctx, domain, recordType, name)
+	if err != nil {
+		return "", set, err
+	}
+
+	if err = p.request(ctx, http.MethodGet, path, nil, &set); err != nil && !isNotFound(err) {
+		return "", set, err
+	}
+
+	return path, set, nil
+}
+
+// Records returns the records in domain with the given type and name.
+// LiveDNS groups records with the same name and type in a record set; each
+// value is returned as a separate record, with the value itself as its ID.
+func (p *Gandi) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	_, set, err := p.recordSet(ctx, domain, recordType, name)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(set.Values))
+
+	for _, value := range set.Values {
+		records = append(records, DNSRecord{
+			ID: value, Type: recordType, Name: name, Data: parseZoneData(recordType, value), TTL: set.TTL,
+		})
+	}
+
+	return records, nil
+}
+
+// CreateRecord adds a record to its record set in domain, creating the set
+// if needed, and returns it as created.
+func (p *Gandi) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	ttl, err := p.replaceValue(ctx, domain, record, "")
+	if err != nil {
+		return record, err
+	}
+
+	record.ID = zoneData(record.Type, record.Data)
+	record.TTL = ttl
+
+	return record, nil
+}
+
+// UpdateRecord replaces the value of an existing record in domain.
+func (p *Gandi) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	_, err := p.replaceValue(ctx, domain, record, record.ID)
+
+	return err
+}
+
+// replaceValue replaces the record set of record, replacing the value old
+// with the record data; if old is empty, the data is added to the set.
+// It returns the TTL of the set.
+func (p *Gandi) replaceValue(ctx context.Context, domain string, record DNSRecord, old string) (int, error) {
+	path, set, err := p.recordSet(ctx, domain, record.Type, record.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	data := zoneData(record.Type, record.Data)
+	values := []string{data}
+
+	for _, value := range set.Values {
+		if value != old && value != data {
+			values = append(values, value)
+		}
+	}
+
+	set.Values = values
+
+	switch {
+	case record.TTL > 0:
+		set.TTL = record.TTL
+	case set.TTL == 0:
+		set.TTL = GandiTTL
+	}
+
+	return set.TTL, p.request(ctx, http.MethodPut, path, set, nil)
+}
+
+// DeleteRecord removes a record from its record set in domain, deleting
+// the set if it was its last value.
+func (p *Gandi) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	path, set, err := p.recordSet(ctx, domain, record.Type, record.Name)
+	if err != nil {
+		return err
+	}
+
+	var values []string
+
+	for _, value := range set.Values {
+		if value != record.ID {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return p.request(ctx, http.MethodDelete, path, nil, nil)
+	}
+
+	set.Values = values
+
+	return p.request(ctx, http.MethodPut, path, set, nil)
+}
+
+// Domains returns the names of all the LiveDNS domains in the account.
+func (p *Gandi) Domains(ctx context.Context) ([]string, error) {
+	var resp []struct {
+		FQDN string `json:"fqdn"`
+	}
+
+	if err := p.request(ctx, http.MethodGet, "/domains", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(resp))
+
+	for _, domain := range resp {
+		names = append(names, domain.FQDN)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// NATPMPPort is the UDP port of NAT-PMP gateways.
+const NATPMPPort = "5351"
+
+// SSDPAddress is the multicast address of UPnP device discovery.
+const SSDPAddress = "239.255.255.250:1900"
+
+// UPnPGateway is the UPnP device type of internet gateways.
+const UPnPGateway = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+
+// GatewayRetransmit is how long to wait for a gateway to answer over UDP
+// before asking again.
+const GatewayRetransmit = time.Second
+
+// NATPMPDetector asks the local gateway for its external IPv4 address with
+// NAT-PMP (RFC 6886), as supported by Apple routers, miniupnpd and others.
+// It needs no external service.
+type NATPMPDetector struct {
+	// Gateway is the address of the gateway; if empty, the default gateway
+	// is used.
+	Gateway string
+}
+
+// UPnPDetector asks the local gateway for its external IPv4 address with
+// UPnP IGD, as supported by most home routers. It needs no external service.
+type UPnPDetector struct{}
+
+// defaultGateway returns the IPv4 default gateway from the Linux routing
+// table.
+func defaultGateway() (string, error) {
+	content, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return "", errors.New("no default gateway found, set it as natpmp:<address>")
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		// The gateway is in hexadecimal, in host byte order.
+		gateway, err := hex.DecodeString(fields[2])
+		if err != nil || len(gateway) != net.IPv4len {
+			continue
+		}
+
+		return net.IPv4(gateway[3], gateway[2], gateway[1], gateway[0]).String(), nil
+	}
+
+	return "", errors.New("no default gateway found, set it as natpmp:<address>")
+}
+
+// exchangeUDP sends request over conn until a response that accept takes is
+// received, or ctx is done.
+func exchangeUDP(
+	ctx context.Context, conn net.PacketConn, to net.Addr, request []byte, accept func([]byte) bool,
+) ([]byte, error) {
+	response := make([]byte, 1500)
+
+	for {
+		if _, err := conn.WriteTo(request, to); err != nil {
+			return nil, err
+		}
+
+		deadline, last := time.Now().Add(GatewayRetransmit), false
+		if end, ok := ctx.Deadline(); ok && end.Before(deadline) {
+			deadline, last = end, true
+		}
+
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+
+		for {
+			n, _, err := conn.ReadFrom(response)
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if accept(response[:n]) {
+				return response[:n], nil
+			}
+		}
+
+		if last {
+			return nil, context.DeadlineExceeded
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Detect returns the external IPv4 address of the gateway.
+func (d NATPMPDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	if ipv6 {
+		return nil, errors.New("address family not supported")
+	}
+
+	gateway := d.Gateway
+	if gateway == "" {
+		var err error
+
+		if gateway, err = defaultGateway(); err != nil {
+			return nil, err
+		}
+	}
+
+	to, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(gateway, NATPMPPort))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := listenUDP(ctx, "udp4", bindAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(conn net.PacketConn) {
+		_ = conn.Close()
+	}(conn)
+
+	// Version 0, opcode 0 asks for the external address; the response has
+	// opcode 128, a result code, the gateway epoch and the address.
+	response, err := exchangeUDP(ctx, conn, to, []byte{0, 0}, func(msg []byte) bool {
+		return len(msg) >= 12 && msg[0] == 0 && msg[1] == 128
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result := binary.BigEndian.Uint16(response[2:]); result != 0 {
+		return nil, fmt.Errorf("NAT-PMP request rejected with result code %d", result)
+	}
+
+	return net.IPv4(response[8], response[9], response[10], response[11]), nil
+}
+
+// String returns the gateway asked.
+func (d NATPMPDetector) String() string {
+	if d.Gateway == "" {
+		return "NAT-PMP at the default gateway"
+	}
+
+	return "NAT-PMP at " + d.Gateway
+}
+
+// upnpDevice is a UPnP device description, with its embedded devices.
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// wanService returns the type and control URL of the service that tells
+// the external address, in device or its embedded devices.
+func (device upnpDevice) wanService() (string, string) {
+	for _, service := range device.Services {
+		if strings.HasPrefix(service.ServiceType, "urn:schemas-upnp-org:service:WANIPConnection:") ||
+			strings.HasPrefix(service.ServiceType, "urn:schemas-upnp-org:service:WANPPPConnection:") {
+			return service.ServiceType, service.ControlURL
+		}
+	}
+
+	for _, embedded := range device.Devices {
+		if serviceType, controlURL := embedded.wanService(); controlURL != "" {
+			return serviceType, controlURL
+		}
+	}
+
+	return "", ""
+}
+
+// newLANClient returns an HTTP client for devices in the local network,
+// which never goes through a proxy.
+func newLANClient(bindAddress net.IP) *http.Client {
+	return &http.Client{Transport: &http.Transport{DialContext: newDialer("tcp", bindAddress).DialContext}}
+}
+
+// deviceRequest sends a GET request to the API of a router or firewall on
+// the local network, and decodes the response.
+func deviceRequest(
+	ctx context.Context, name, target string, header http.Header, bindAddress net.IP, out interface{},
+) error {
+	err := requestJSON(ctx, newLANClient(bindAddress), http.MethodGet, target, header, nil, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check the %s API credentials and privileges", ErrUnauthorized, name)
+	}
+
+	return err
+}
+
+// discoverGateway returns the URL of the device description of the first
+// UPnP internet gateway to answer.
+func discoverGateway(ctx context.Context, bindAddress net.IP) (string, error) {
+	to, err := net.ResolveUDPAddr("udp4", SSDPAddress)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := listenUDP(ctx, "udp4", bindAddress)
+	if err != nil {
+		return "", err
+	}
+
+	defer func(conn net.PacketConn) {
+		_ = conn.Close()
+	}(conn)
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + SSDPAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + UPnPGateway + "\r\n\r\n"
+
+	var location string
+
+	_, err = exchangeUDP(ctx, conn, to, []byte(search), func(msg []byte) bool {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(msg)), nil)
+		if err != nil {
+			return false
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return false
+		}
+
+		location = resp.Header.Get("Location")
+
+		return location != ""
+	})
+
+	return location, err
+}
+
+// Detect returns the external IPv4 address of the gateway.
+func (UPnPDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	if ipv6 {
+		return nil, errors.New("address family not supported")
+	}
+
+	location, err := discoverGateway(ctx, bindAddress)
+	if err != nil {
+		return nil, fmt.Errorf("no UPnP gateway found, %w", err)
+	}
+
+	client := newLANClient(bindAddress)
+
+	var description struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+
+	if err = requestXML(ctx, client, http.MethodGet, location, nil, nil, &description); err != nil {
+		return nil, err
+	}
+
+	serviceType, controlURL := description.Device.wanService()
+	if controlURL == "" {
+		return nil, errors.New("the UPnP gateway has no WAN connection service")
+	}
+
+	base := location
+	if description.URLBase != "" {
+		base = description.URLBase
+	}
+
+	target, err := resolveURL(base, controlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				Address string `xml:"NewExternalIPAddress"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+
+	if err = soapRequest(ctx, client, target, serviceType, "GetExternalIPAddress", &envelope); err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(envelope.Body.Response.Address))
+	if ip == nil {
+		return nil, errors.New("the UPnP gateway has no external address")
+	}
+
+	return ip, nil
+}
+
+// String returns the name of the detector.
+func (UPnPDetector) String() string {
+	return "UPnP gateway"
+}
+
+// resolveURL resolves reference against base.
+func resolveURL(base, reference string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(reference)
+	if err != nil {
+		return "", err
+	}
+
+	return baseURL.ResolveReference(ref).String(), nil
+}
+
+// soapRequest calls action, without arguments, of a UPnP service at target
+// and decodes the response envelope into out.
+func soapRequest(
+	ctx context.Context, client *http.Client, target, serviceType, action string, out interface{},
+) error {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + serviceType + `"/></s:Body></s:Envelope>`
+
+	header := http.Header{}
+	header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	header.Set("SOAPAction", `"`+serviceType+"#"+action+`"`)
+
+	return requestXML(ctx, client, http.MethodPost, target, header, strings.NewReader(body), out)
+}
+
+// requestXML sends a request and decodes the XML response into out.
+func requestXML(
+	ctx context.Context, client *http.Client, method, target string, header http.Header, body io.Reader, out interface{},
+) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(content))}
+	}
+
+	return xml.Unmarshal(content, out)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GoogleDNSAPI is the base URL of the Cloud DNS API.
+const GoogleDNSAPI = "https://dns.googleapis.com/dns/v1"
+
+// GoogleDNSScope is the OAuth scope needed to change Cloud DNS records.
+const GoogleDNSScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+
+// GoogleTokenURI is the default OAuth token endpoint for service accounts.
+const GoogleTokenURI = "https://oauth2.googleapis.com/token"
+
+// GoogleDNSTTL is the TTL of new Cloud DNS records, which have no default.
+const GoogleDNSTTL = 300
+
+// GoogleConfig is the "google" section of the config file.
+type GoogleConfig struct {
+	// CredentialsFile is the path to a service account JSON key. It defaults
+	// to $GOOGLE_APPLICATION_CREDENTIALS.
+	CredentialsFile string `json:"credentials_file"`
+	// Project defaults to the project of the service account.
+	Project string `json:"project"`
+	// Zones maps domains to managed zone names. Domains not listed here are
+	// looked up by DNS name.
+	Zones map[string]string `json:"zones"`
+}
+
+// googleServiceAccount is the part of a service account JSON key we use.
+type googleServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	PrivateKey  string `json:"private_key"`
+	ClientEmail string `json:"client_email"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// GoogleDNS is the Google Cloud DNS provider.
+type GoogleDNS struct {
+	client  *http.Client
+	account googleServiceAccount
+	key     *rsa.PrivateKey
+	project string
+	// zones caches managed zone names by domain.
+	zones map[string]string
+	// token is the current OAuth access token, valid until expiry.
+	token  string
+	expiry time.Time
+}
+
+// googleRecordSet is a resource record set in the Cloud DNS API.
+type googleRecordSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	RRDatas []string `json:"rrdatas"`
+}
+
+// newGoogleDNS returns a Google Cloud DNS provider.
+func newGoogleDNS(config GoogleConfig) (*GoogleDNS, error) {
+	if config.CredentialsFile == "" {
+		config.CredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	if config.CredentialsFile == "" {
+		return nil, errors.New("missing Google service account credentials file")
+	}
+
+	content, err := os.ReadFile(config.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var account googleServiceAccount
+
+	if err = json.Unmarshal(content, &account); err != nil {
+		return nil, fmt.Errorf("invalid Google credentials file %s; %w", config.CredentialsFile, err)
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("missing private key in Google credentials file %s", config.CredentialsFile)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the Google service account key is not an RSA key")
+	}
+
+	if config.Project == "" {
+		config.Project = account.ProjectID
+	}
+
+	if account.TokenURI == "" {
+		account.TokenURI = GoogleTokenURI
+	}
+
+	zones := map[string]string{}
+	for domain, zone := range config.Zones {
+		zones[domain] = zone
+	}
+
+	return &GoogleDNS{client: newAPIClient(), account: account, key: key, project: config.Project, zones: zones}, nil
+}
+
+// accessToken returns an OAuth access token for the service account,
+// getting a new one when the current one is about to expire.
+func (p *GoogleDNS) accessToken(ctx context.Context) (string, error) {
+	now := time.Now()
+
+	if p.token != "" && now.Add(time.Minute).Before(p.expiry) {
+		return p.token, nil
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   p.account.ClientEmail,
+		"scope": GoogleDNSScope,
+		"aud":   p.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	unsigned := encode(header) + "." + encode(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", unsigned+"."+encode(signature))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w, Google rejected the service account key: %s", ErrUnauthorized, resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	p.token = token.AccessToken
+	p.expiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return p.token, nil
+}
+
+// request sends a request to the Cloud DNS API and decodes the response.
+func (p *GoogleDNS) request(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+
+	target := GoogleDNSAPI + "/projects/" + url.PathEscape(p.project) + path
+	err = requestJSON(ctx, p.client, method, target, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check that the service account has the DNS Administrator role", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// zone returns the name of the managed zone for domain.
+func (p *GoogleDNS) zone(ctx context.Context, domain string) (string, error) {
+	if zone, ok := p.zones[domain]; ok {
+		return zone, nil
+	}
+
+	var resp struct {
+		ManagedZones []struct {
+			Name string `json:"name"`
+		} `json:"managedZones"`
+	}
+
+	path := "/managedZones?dnsName=" + url.QueryEscape(domain+".")
+
+	if err := p.request(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.ManagedZones) == 0 {
+		return "", fmt.Errorf("%w in Google Cloud project %s: %s", ErrDomainNotFound, p.project, domain)
+	}
+
+	p.zones[domain] = resp.ManagedZones[0].Name
+
+	return resp.ManagedZones[0].Name, nil
+}
+
+// recordSet returns the zone of domain and its record set with the given
+// type and name, or nil if there is none.
+func (p *GoogleDNS) recordSet(ctx context.Context, domain, recordType, name string) (string, *googleRecordSet, error) {
+	zone, err := p.zone(ctx, domain)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := url.Values{}
+	query.Set("name", absoluteName(name, domain)+".")
+	query.Set("type", recordType)
+
+	var resp struct {
+		RRSets []googleRecordSet `json:"rrsets"`
+	}
+
+	if err = p.request(ctx, http.MethodGet, "/managedZones/"+zone+"/rrsets?"+query.Encode(), nil, &resp); err != nil {
+		return "", nil, err
+	}
+
+	if len(resp.RRSets) == 0 {
+		return zone, nil, nil
+	}
+
+	return zone, &resp.RRSets[0], nil
+}
+
+// change replaces the record set deletion, if not nil, with addition, if
+// not nil, in a single change.
+func (p *GoogleDNS) change(ctx context.Context, zone string, deletion, addition *googleRecordSet) error {
+	var body struct {
+		Additions []googleRecordSet `json:"additions,omitempty"`
+		Deletions []googleRecordSet `json:"deletions,omitempty"`
+	}
+
+	if deletion != nil {
+		body.Deletions = []googleRecordSet{*deletion}
+	}
+
+	if addition != nil {
+		body.Additions = []googleRecordSet{*addition}
+	}
+
+	return p.request(ctx, http.MethodPost, "/managedZones/"+zone+"/changes", body, nil)
+}
+
+// Records returns the records in domain with the given type and name.
+// Cloud DNS groups records with the same name and type in a record set;
+// each value is returned as a separate record, with the value itself as
+// its ID.
+func (p *GoogleDNS) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	_, set, err := p.recordSet(ctx, domain, recordType, name)
+	if err != nil || set == nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(set.RRDatas))
+
+	for _, value := range set.RRDatas {
+		records = append(records, DNSRecord{
+			ID: value, Type: recordType, Name: name, Data: parseZoneData(recordType, value), TTL: set.TTL,
+		})
+	}
+
+	return records, nil
+}
+
+// CreateRecord adds a record to its record set in domain, creating the set
+// if needed, and returns it as created.
+func (p *GoogleDNS) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	ttl, err := p.replaceValue(ctx, domain, record, "")
+	if err != nil {
+		return record, err
+	}
+
+	record.ID = zoneData(record.Type, record.Data)
+	record.TTL = ttl
+
+	return record, nil
+}
+
+// UpdateRecord replaces the value of an existing record in domain.
+func (p *GoogleDNS) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	_, err := p.replaceValue(ctx, domain, record, record.ID)
+
+	return err
+}
+
+// replaceValue replaces the record set of record, replacing the value old
+// with the record data; if old is empty, the data is added to the set.
+// It returns the TTL of the set.
+func (p *GoogleDNS) replaceValue(ctx context.Context, domain string, record DNSRecord, old string) (int, error) {
+	zone, set, err := p.recordSet(ctx, domain, record.Type, record.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	data := zoneData(record.Type, record.Data)
+	addition := googleRecordSet{
+		Name:    absoluteName(record.Name, domain) + ".",
+		Type:    record.Type,
+		TTL:     GoogleDNSTTL,
+		RRDatas: []string{data},
+	}
+
+	if set != nil {
+		addition.TTL = set.TTL
+
+		for _, value := range set.RRDatas {
+			if value != old && value != data {
+				addition.RRDatas = append(addition.RRDatas, value)
+			}
+		}
+	}
+
+	if record.TTL > 0 {
+		addition.TTL = record.TTL
+	}
+
+	return addition.TTL, p.change(ctx, zone, set, &addition)
+}
+
+// DeleteRecord removes a record from its record set in domain, deleting
+// the set if it was its last value.
+func (p *GoogleDNS) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	zone, set, err := p.recordSet(ctx, domain, record.Type, record.Name)
+	if err != nil {
+		return err
+	}
+
+	if set == nil {
+		return errors.New("record set not found")
+	}
+
+	addition := *set
+	addition.RRDatas = nil
+
+	for _, value := range set.RRDatas {
+		if value != record.ID {
+			addition.RRDatas = append(addition.RRDatas, value)
+		}
+	}
+
+	if len(addition.RRDatas) == 0 {
+		return p.change(ctx, zone, set, nil)
+	}
+
+	return p.change(ctx, zone, set, &addition)
+}
+
+// Domains returns the DNS names of all the managed zones in the project.
+func (p *GoogleDNS) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for pageToken := ""; ; {
+		var resp struct {
+			ManagedZones []struct {
+				DNSName string `json:"dnsName"`
+			} `json:"managedZones"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+
+		path := "/managedZones?pageToken=" + url.QueryEscape(pageToken)
+
+		if err := p.request(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, zone := range resp.ManagedZones {
+			names = append(names, strings.TrimSuffix(zone.DNSName, "."))
+		}
+
+		if pageToken = resp.NextPageToken; pageToken == "" {
+			return names, nil
+		}
+	}
+}
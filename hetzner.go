@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// HetznerAPI is the base URL of the Hetzner DNS API.
+const HetznerAPI = "https://dns.hetzner.com/api/v1"
+
+// HetznerConfig is the "hetzner" section of the config file.
+type HetznerConfig struct {
+	// Token is a Hetzner DNS API token.
+	Token string `json:"token"`
+}
+
+// Hetzner is the Hetzner DNS provider.
+type Hetzner struct {
+	client *http.Client
+	token  string
+	// zones caches zone IDs by domain.
+	zones map[string]string
+}
+
+// hetznerRecord is a DNS record in the Hetzner DNS API.
+type hetznerRecord struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+// newHetzner returns a Hetzner DNS provider.
+func newHetzner(config HetznerConfig) (*Hetzner, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing Hetzner token")
+	}
+
+	return &Hetzner{client: newAPIClient(), token: config.Token, zones: map[string]string{}}, nil
+}
+
+// request sends a request to the Hetzner DNS API and decodes the response.
+func (p *Hetzner) request(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+	header.Set("Auth-API-Token", p.token)
+
+	err := requestJSON(ctx, p.client, method, HetznerAPI+path, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w, check that the Hetzner DNS token is valid", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// zoneID returns the ID of the zone for domain.
+func (p *Hetzner) zoneID(ctx context.Context, domain string) (string, error) {
+	if id, ok := p.zones[domain]; ok {
+		return id, nil
+	}
+
+	var resp struct {
+		Zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+	}
+
+	// Hetzner answers 404 for unknown zone names.
+	err := p.request(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(domain), nil, &resp)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		err = nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Zones) == 0 {
+		return "", fmt.Errorf("%w in Hetzner account: %s", ErrDomainNotFound, domain)
+	}
+
+	p.zones[domain] = resp.Zones[0].ID
+
+	return resp.Zones[0].ID, nil
+}
+
+// Records returns the records in domain with the given type and name.
+func (p *Hetzner) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Records []hetznerRecord `json:"records"`
+	}
+
+	if err = p.request(ctx, http.MethodGet, "/records?zone_id="+url.QueryEscape(zone), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var matches []DNSRecord
+
+	for _, record := range resp.Records {
+		if record.Type == recordType && record.Name == name {
+			matches = append(matches, DNSRecord{
+				ID:   record.ID,
+				Type: record.Type,
+				Name: record.Name,
+				Data: record.Value,
+				TTL:  record.TTL,
+			})
+		}
+	}
+
+	return matches, nil
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *Hetzner) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return record, err
+	}
+
+	var resp struct {
+		Record hetznerRecord `json:"record"`
+	}
+
+	body := hetznerRecord{
+		ZoneID: zone, Type: record.Type, Name: record.Name, Value: absoluteData(record.Type, record.Data), TTL: record.TTL,
+	}
+
+	if err = p.request(ctx, http.MethodPost, "/records", body, &resp); err != nil {
+		return record, err
+	}
+
+	record.ID = resp.Record.ID
+	record.TTL = resp.Record.TTL
+
+	return record, nil
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *Hetzner) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	body := hetznerRecord{
+		ZoneID: zone, Type: record.Type, Name: record.Name, Value: absoluteData(record.Type, record.Data), TTL: record.TTL,
+	}
+
+	return p.request(ctx, http.MethodPut, "/records/"+record.ID, body, nil)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *Hetzner) DeleteRecord(ctx context.Context, _ string, record DNSRecord) error {
+	return p.request(ctx, http.MethodDelete, "/records/"+record.ID, nil, nil)
+}
+
+// Domains returns the names of all the zones in the account.
+func (p *Hetzner) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for page := 1; ; page++ {
+		var resp struct {
+			Zones []struct {
+				Name string `json:"name"`
+			} `json:"zones"`
+			Meta struct {
+				Pagination struct {
+					LastPage int `json:"last_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+
+		if err := p.request(ctx, http.MethodGet, fmt.Sprintf("/zones?per_page=100&page=%d", page), nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, zone := range resp.Zones {
+			names = append(names, zone.Name)
+		}
+
+		if page >= resp.Meta.Pagination.LastPage {
+			return names, nil
+		}
+	}
+}
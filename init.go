@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// initConfig is the config file written by init, with the settings in the
+// order of config.json.example.
+type initConfig struct {
+	Log     string         `json:"log"`
+	Token   string         `json:"token"`
+	Records []configRecord `json:"records"`
+}
+
+// configRecord is a record of a config file written by do-dyndns, with
+// only the settings used.
+type configRecord struct {
+	Type      string `json:"type"`
+	Subdomain string `json:"subdomain"`
+	Provider  string `json:"provider,omitempty"`
+	Token     string `json:"token,omitempty"`
+	TTL       int    `json:"ttl,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	IP        string `json:"ip,omitempty"`
+}
+
+// prompter asks questions on standard output, and reads the answers from
+// input.
+type prompter struct {
+	input *bufio.Scanner
+}
+
+// ask writes question and returns the answer, or fallback if it is empty.
+func (p prompter) ask(question, fallback string) (string, error) {
+	if fallback != "" {
+		question = fmt.Sprintf("%s [%s]", question, fallback)
+	}
+
+	fmt.Print(question + ": ")
+
+	if !p.input.Scan() {
+		if err := p.input.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.ErrUnexpectedEOF
+	}
+
+	if answer := strings.TrimSpace(p.input.Text()); answer != "" {
+		return answer, nil
+	}
+
+	return fallback, nil
+}
+
+// runInit asks for a DigitalOcean token, checks it by listing the domains
+// of the account, and for the records to set, and writes them to the config
+// file, configFile or that in the user config directory if empty, which must
+// not exist yet.
+func runInit(input io.Reader, configFile string) (string, error) {
+	if configFile == "" {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+
+		configFile = filepath.Join(userConfigDir, Prog, ConfigFile)
+	}
+
+	if _, err := os.Stat(configFile); err == nil {
+		return "", fmt.Errorf("%s already exists", configFile)
+	}
+
+	p := prompter{input: bufio.NewScanner(input)}
+
+	token, err := p.ask("DigitalOcean token", "")
+	if err != nil {
+		return "", err
+	} else if token == "" {
+		return "", errors.New("missing token")
+	}
+
+	provider, err := newDigitalOcean(token)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), APITimeout)
+	domains, err := provider.Domains(ctx)
+
+	cancel()
+
+	if err != nil {
+		return "", fmt.Errorf("error checking the token; %w", err)
+	}
+
+	fmt.Printf("The token manages %s.\n", strings.Join(domains, ", "))
+
+	config := initConfig{Log: "$HOME/.cache/" + Prog + "/out.log", Token: token}
+	zones := Zones{provider: domains}
+
+	for {
+		var subdomain, recordType string
+
+		if subdomain, err = p.ask("Subdomain to set, empty to finish", ""); err != nil {
+			return "", err
+		} else if subdomain == "" {
+			break
+		}
+
+		record := Record{Subdomain: subdomain}
+		if _, _, err = record.split(); err != nil {
+			fmt.Println(err)
+
+			continue
+		}
+
+		if _, domain := zones.split(provider, record, APITimeout); !hasDomain(domains, domain) {
+			fmt.Printf("The domain %s is not in the account.\n", domain)
+
+			continue
+		}
+
+		if recordType, err = p.ask("Record type: A, AAAA, A+AAAA or AUTO", "A"); err != nil {
+			return "", err
+		}
+
+		recordType = strings.ToUpper(recordType)
+		if !knownType(recordType) || StaticTypes[recordType] {
+			fmt.Printf("invalid type, %s\n", recordType)
+
+			continue
+		}
+
+		config.Records = append(config.Records, configRecord{Type: recordType, Subdomain: subdomain})
+	}
+
+	if len(config.Records) == 0 {
+		return "", errors.New("no records to set")
+	}
+
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		return "", err
+	}
+
+	// The file holds the token.
+	if err = os.WriteFile(configFile, append(content, '\n'), 0600); err != nil {
+		return "", err
+	}
+
+	return configFile, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InterfaceDetector reads the public IP address directly from a network
+// interface, for hosts with a public address on the NIC. It needs no
+// external service.
+type InterfaceDetector struct {
+	// Name is the name of the interface, e.g. "eth0".
+	Name string
+}
+
+// Linux IPv6 address flags, from linux/if_addr.h.
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDADFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+)
+
+// ifaFlagsUnstable are the flags of IPv6 addresses that should not be
+// published: RFC 4941 temporary addresses rotate every few hours, and the
+// others are going away or not usable yet.
+const ifaFlagsUnstable = ifaFlagTemporary | ifaFlagDADFailed | ifaFlagDeprecated | ifaFlagTentative
+
+// ipv6Flags returns the flags of the IPv6 addresses of interface name, by
+// address, from /proc/net/if_inet6. It returns nil where not available.
+func ipv6Flags(name string) map[string]uint64 {
+	content, err := os.ReadFile("/proc/net/if_inet6")
+	if err != nil {
+		return nil
+	}
+
+	flags := map[string]uint64{}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		// Address, index, prefix length, scope, flags and interface name.
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[5] != name {
+			continue
+		}
+
+		address, err := hex.DecodeString(fields[0])
+		if err != nil || len(address) != net.IPv6len {
+			continue
+		}
+
+		if value, err := strconv.ParseUint(fields[4], 16, 32); err == nil {
+			flags[net.IP(address).String()] = value
+		}
+	}
+
+	return flags
+}
+
+// Detect returns the best address of the interface in the family: a public
+// address, stable rather than temporary for IPv6, or else any other address
+// except link-local ones.
+func (d InterfaceDetector) Detect(_ context.Context, ipv6 bool, _ net.IP) (net.IP, error) {
+	iface, err := net.InterfaceByName(d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var flags map[string]uint64
+	if ipv6 {
+		flags = ipv6Flags(d.Name)
+	}
+
+	var best net.IP
+
+	bestRank := 0
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() == nil) != ipv6 || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+
+		// Public beats non-public, and stable beats unstable.
+		rank := 1
+		if isPublic(ipNet.IP) {
+			rank = 2
+			if flags[ipNet.IP.String()]&ifaFlagsUnstable == 0 {
+				rank = 3
+			}
+		}
+
+		if rank > bestRank {
+			best, bestRank = ipNet.IP, rank
+		}
+	}
+
+	// A non-public address is rejected later, unless allowed.
+	if best == nil {
+		return nil, errors.New("no address on the interface")
+	}
+
+	return best, nil
+}
+
+// String returns the interface.
+func (d InterfaceDetector) String() string {
+	return fmt.Sprintf("interface %s", d.Name)
+}
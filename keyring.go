@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeyringService and KeyringAccount name the token in the system keyring.
+const (
+	KeyringService = Prog
+	KeyringAccount = "token"
+)
+
+// TokenSourceKeyring is the "token_source" of a token kept in the system
+// keyring, set with the token command.
+const TokenSourceKeyring = "keyring"
+
+// runToken runs the token command: with "set", it stores the token read
+// from input in the system keyring, and with "get", prints it.
+func runToken(action string, input io.Reader) error {
+	switch action {
+	case "set":
+		token, err := prompter{input: bufio.NewScanner(input)}.ask("DigitalOcean token", "")
+		if err != nil {
+			return err
+		} else if token == "" {
+			return errors.New("missing token")
+		}
+
+		if err = keyringSet(KeyringAccount, token); err != nil {
+			return err
+		}
+
+		writeOut("stored the token in the keyring")
+	case "get":
+		token, err := keyringGet(KeyringAccount)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(token)
+	default:
+		return fmt.Errorf("unknown token action, %q; use set or get", action)
+	}
+
+	return nil
+}
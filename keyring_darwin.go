@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// keyringGet returns the secret of account in the login keychain, with
+// security.
+func keyringGet(account string) (string, error) {
+	output, err := exec.Command("security", "find-generic-password",
+		"-s", KeyringService, "-a", account, "-w").Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(output) == 0 {
+		return "", fmt.Errorf("no %s in the keychain", account)
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// keyringSet stores secret as that of account in the login keychain, with
+// security, replacing the previous one. The command is given on the standard
+// input of security, so that the secret is not in its arguments, which other
+// users can see.
+func keyringSet(account, secret string) error {
+	args := []string{"add-generic-password", "-U", "-s", KeyringService, "-a", account, "-l", Prog + " " + account,
+		"-w", secret}
+
+	for i, arg := range args {
+		args[i] = securityQuote(arg)
+	}
+
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(strings.Join(args, " ") + "\n")
+	cmd.Stdout, cmd.Stderr = io.Discard, os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	// The interactive mode may not exit with the status of the command.
+	if stored, err := keyringGet(account); err != nil || stored != secret {
+		return fmt.Errorf("error storing %s in the keychain", account)
+	}
+
+	return nil
+}
+
+// securityQuote quotes arg for the interactive mode of security, which takes
+// double quotes and backslash escapes as a shell does.
+func securityQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
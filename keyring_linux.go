@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// keyringGet returns the secret of account in the Secret Service keyring,
+// with secret-tool.
+func keyringGet(account string) (string, error) {
+	output, err := exec.Command("secret-tool", "lookup", "service", KeyringService, "account", account).Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(output) == 0 {
+		return "", fmt.Errorf("no %s in the keyring", account)
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// keyringSet stores secret as that of account in the Secret Service
+// keyring, with secret-tool, which reads it from its standard input.
+func keyringSet(account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", Prog+" "+account,
+		"service", KeyringService, "account", account)
+	cmd.Stdin, cmd.Stderr = strings.NewReader(secret), os.Stderr
+
+	return cmd.Run()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LinodeAPI is the base URL of the Linode API.
+const LinodeAPI = "https://api.linode.com/v4"
+
+// LinodeConfig is the "linode" section of the config file.
+type LinodeConfig struct {
+	// Token is a personal access token with Domains read/write access.
+	Token string `json:"token"`
+}
+
+// Linode is the Linode DNS provider.
+type Linode struct {
+	client *http.Client
+	token  string
+	// domains caches domain IDs by domain.
+	domains map[string]int
+}
+
+// linodePage is the envelope of paginated Linode API responses.
+type linodePage struct {
+	Page  int `json:"page"`
+	Pages int `json:"pages"`
+}
+
+// linodeRecord is a domain record in the Linode API.
+type linodeRecord struct {
+	ID     int    `json:"id,omitempty"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTL    int    `json:"ttl_sec,omitempty"`
+	// Priority, Weight, Port, Service and Protocol are the other fields of
+	// SRV records; MX records have a Priority too.
+	Priority *int   `json:"priority,omitempty"`
+	Weight   *int   `json:"weight,omitempty"`
+	Port     *int   `json:"port,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// newLinode returns a Linode DNS provider.
+func newLinode(config LinodeConfig) (*Linode, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing Linode token")
+	}
+
+	return &Linode{client: newAPIClient(), token: config.Token, domains: map[string]int{}}, nil
+}
+
+// request sends a request to the Linode API and decodes the response.
+func (p *Linode) request(ctx context.Context, method, path string, header http.Header, body, out interface{}) error {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	header.Set("Authorization", "Bearer "+p.token)
+
+	err := requestJSON(ctx, p.client, method, LinodeAPI+path, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check that the Linode token is valid and has Domains read/write access", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// domainID returns the ID of domain.
+func (p *Linode) domainID(ctx context.Context, domain string) (int, error) {
+	if id, ok := p.domains[domain]; ok {
+		return id, nil
+	}
+
+	var resp struct {
+		linodePage
+		Data []struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+
+	filter, err := json.Marshal(map[string]string{"domain": domain})
+	if err != nil {
+		return 0, err
+	}
+
+	header := http.Header{}
+	header.Set("X-Filter", string(filter))
+
+	if err = p.request(ctx, http.MethodGet, "/domains", header, nil, &resp); err != nil {
+		return 0, err
+	}
+
+	if len(resp.Data) == 0 {
+		return 0, fmt.Errorf("%w in Linode account: %s", ErrDomainNotFound, domain)
+	}
+
+	p.domains[domain] = resp.Data[0].ID
+
+	return resp.Data[0].ID, nil
+}
+
+// recordsPath returns the API path of the records of domain.
+func (p *Linode) recordsPath(ctx context.Context, domain string) (string, error) {
+	id, err := p.domainID(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+
+	return "/domains/" + strconv.Itoa(id) + "/records", nil
+}
+
+// Records returns the records in domain with the given type and name.
+func (p *Linode) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	path, err := p.recordsPath(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []DNSRecord
+
+	for page := 1; ; page++ {
+		var resp struct {
+			linodePage
+			Data []linodeRecord `json:"data"`
+		}
+
+		query := fmt.Sprintf("?page_size=500&page=%d", page)
+
+		if err = p.request(ctx, http.MethodGet, path+query, nil, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			if record.Type == recordType && record.Name == blankApex(name) {
+				matches = append(matches, DNSRecord{
+					ID:   strconv.Itoa(record.ID),
+					Type: record.Type,
+					Name: name,
+					Data: record.data(),
+					TTL:  record.TTL,
+				})
+			}
+		}
+
+		if page >= resp.Pages {
+			return matches, nil
+		}
+	}
+}
+
+// data returns the data of a Linode record, with the numbers of SRV and MX
+// records before their target.
+func (record linodeRecord) data() string {
+	switch {
+	case record.Type == "SRV" && record.Priority != nil && record.Weight != nil && record.Port != nil:
+		return joinData([]int{*record.Priority, *record.Weight, *record.Port}, record.Target)
+	case record.Type == "MX" && record.Priority != nil:
+		return joinData([]int{*record.Priority}, record.Target)
+	}
+
+	return record.Target
+}
+
+// toLinode converts a DNSRecord to a Linode record.
+// Linode names SRV records after their service and protocol, such as
+// "_sip._tcp", given without the underscores.
+func toLinode(record DNSRecord) linodeRecord {
+	converted := linodeRecord{Type: record.Type, Name: blankApex(record.Name), Target: record.Data, TTL: record.TTL}
+
+	switch record.Type {
+	case "MX":
+		numbers, target := dataFields(record.Type, record.Data)
+		converted.Priority, converted.Target = &numbers[0], target
+	case "SRV":
+		numbers, target := dataFields(record.Type, record.Data)
+		converted.Priority, converted.Weight, converted.Port = &numbers[0], &numbers[1], &numbers[2]
+		converted.Target = target
+
+		labels := strings.SplitN(record.Name, ".", 3)
+		if len(labels) >= 2 {
+			converted.Service = strings.TrimPrefix(labels[0], "_")
+			converted.Protocol = strings.TrimPrefix(labels[1], "_")
+		}
+	}
+
+	return converted
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *Linode) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	path, err := p.recordsPath(ctx, domain)
+	if err != nil {
+		return record, err
+	}
+
+	var created linodeRecord
+
+	if err = p.request(ctx, http.MethodPost, path, nil, toLinode(record), &created); err != nil {
+		return record, err
+	}
+
+	record.ID = strconv.Itoa(created.ID)
+	record.TTL = created.TTL
+
+	return record, nil
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *Linode) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	path, err := p.recordsPath(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return p.request(ctx, http.MethodPut, path+"/"+record.ID, nil, toLinode(record), nil)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *Linode) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	path, err := p.recordsPath(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return p.request(ctx, http.MethodDelete, path+"/"+record.ID, nil, nil, nil)
+}
+
+// Domains returns the names of all the domains in the account.
+func (p *Linode) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for page := 1; ; page++ {
+		var resp struct {
+			linodePage
+			Data []struct {
+				Domain string `json:"domain"`
+			} `json:"data"`
+		}
+
+		query := fmt.Sprintf("?page_size=500&page=%d", page)
+
+		if err := p.request(ctx, http.MethodGet, "/domains"+query, nil, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, domain := range resp.Data {
+			names = append(names, domain.Domain)
+		}
+
+		if page >= resp.Pages {
+			return names, nil
+		}
+	}
+}
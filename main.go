@@ -6,19 +6,30 @@ It is intended to be run as a cron job or a systemd service.
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/syslog"
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
-	"github.com/digitalocean/godo"
 	"github.com/jbrodriguez/mlog"
 	"golang.org/x/sys/unix"
 )
@@ -30,39 +41,736 @@ const Version = "1.0.1"
 const ConfigFile = "config.json"
 const DotConfigFile = "." + Prog + ".json"
 
+// SystemConfigDir is the system config directory, with a directory for the
+// config file, looked in after the user config directory.
+const SystemConfigDir = "/etc"
+
+// ConfigFiles are the names of the config file looked for in the config
+// directory, in order: JSON, YAML, then TOML.
+var ConfigFiles = []string{ConfigFile, "config.yaml", "config.yml", "config.toml"}
+
+// Environment variables with the config, for containers without a config
+// file. Those of settings override the config file.
+const (
+	// ConfigFileEnv is the path of the config file, as with --config.
+	ConfigFileEnv = "DYNDNS_CONFIG_FILE"
+	// ConfigJSONEnv is the whole config, as JSON, instead of a file.
+	ConfigJSONEnv = "DYNDNS_CONFIG_JSON"
+	// RecordsEnv are the records, as TYPE:SUBDOMAIN separated by commas, or
+	// just SUBDOMAIN for A records.
+	RecordsEnv  = "DYNDNS_RECORDS"
+	TokenEnv    = "DYNDNS_TOKEN"
+	ProviderEnv = "DYNDNS_PROVIDER"
+	TTLEnv      = "DYNDNS_TTL"
+)
+
 // LogFile name and parameters passed to mlog.
 const LogFile = "out.log"
 const LogFileCount = 3
 const LogFileSize = 128 * 1024
 
-const Usage = `Usage: %s [OPTIONS]
+// DefaultInterval is the time between updates in daemon mode.
+const DefaultInterval = 5 * time.Minute
+
+// VerifyAttempts and VerifyDelay control how long to wait for a record
+// to be updated after setting it, with --verify.
+const VerifyAttempts = 5
+const VerifyDelay = 2 * time.Second
+
+// LastRunFile records the time of the last run, in the user cache directory.
+const LastRunFile = "last-run"
+
+// HealthcheckTimeout bounds the time spent pinging a monitoring URL, and
+// APITimeout the provider API calls to set each record, unless set
+// otherwise in the config file.
+const HealthcheckTimeout = 10 * time.Second
+const APITimeout = 30 * time.Second
+
+// TokenCmdTimeout bounds the command that prints the token, which may wait
+// for a passphrase.
+const TokenCmdTimeout = 2 * time.Minute
+
+const Usage = `Usage: %s [COMMAND] [OPTIONS]
+
+COMMANDS
+    list                    print the records of the configured subdomains as
+                            they are at their providers
+    status                  print whether the records are as they should be,
+                            without changing them
+    ip                      print the detected public IP addresses
+    delete                  delete the records of --subdomain or --domain, or
+                            with --all those of the config file
+    validate                check the config file; with --online, also the
+                            credentials and domains with the providers
+    init                    ask for a token and records, and write the config
+                            file
+    import --from ddclient [FILE]
+                            print the config converted from the ddclient
+                            config FILE, /etc/ddclient/ddclient.conf by default
+    token set, token get    store the DigitalOcean token in the system keyring,
+                            read from standard input, or print it
+    export --domain DOMAIN [NAME...]
+                            print the config of the A and AAAA records of
+                            DOMAIN, or only those of the NAMEs
 
 OPTIONS
-    -h, --help    display this help and exit
-    -v, --version display version information and exit
+    --type TYPE             record TYPE: A (default), AAAA, A+AAAA or AUTO
+    --subdomain SUBDOMAIN   set SUBDOMAIN instead of the configured records;
+                            repeat it to set several, each of the --type after
+                            it
+    --domain DOMAIN         set a record in DOMAIN instead of the configured ones
+    --record-name NAME      record NAME in DOMAIN, @ for the domain itself
+    --verify                check that records were actually set
+    --force                 rewrite the records even if already as they should
+                            be
+    --daemon                keep running, setting the records every 5 minutes
+    --interval DURATION     keep running, setting the records every DURATION
+    --clamp-interval        raise the interval to at least the record TTL
+    --watch-config          with daemon, reload the config file when it changes
+    --bind-address ADDRESS  detect the public IP and call the APIs from a local
+                            ADDRESS
+    --bind-interface NAME   detect the public IP and call the APIs through
+                            network interface NAME
+    --interface NAME        read the public IP from network interface NAME
+    --ip ADDRESS            set ADDRESS instead of detecting the public IP;
+                            repeat to give both an IPv4 and an IPv6 address
+    --ip-from FILE          read the addresses to set from FILE, - for stdin
+    --log-target TARGET     write messages to TARGET: stdout, file or syslog
+    --config FILE           read the config from FILE, also set with
+                            DYNDNS_CONFIG_FILE
+    --identity FILE         decrypt an age or sops encrypted config file with
+                            the age identity FILE
+    --no-legacy-config      do not fall back to $HOME/.%s.json
+    --read-only             never write to the filesystem: no log file, state
+                            file or last run file
+    --token-file FILE       read the DigitalOcean token from FILE
+    --profile NAME          use the settings of profile NAME of the config file
+    --healthcheck-url URL   ping URL after all records are set successfully
+    --healthcheck-fail      ping URL/fail if any record could not be set
+    --list-domains          list the domains managed by the account and exit
+    --4, --6                with ip, detect only the IPv4 or IPv6 address
+    --json                  with ip, print the addresses and their sources as
+                            JSON
+    --prepare               lower the TTL of the records ahead of an address
+                            change and exit
+    --dedupe                delete duplicate records, keeping one for each
+                            subdomain and type
+    -h, --help              display this help and exit
+    -v, --version           display version information and exit
 
 FILES
-    $HOME/.config/%s/config.json
+    $HOME/.config/%s/config.json, config.yaml or config.toml
+    $HOME/.%s.json (legacy)
+    $XDG_CONFIG_DIRS/do-dyndns/config.json, /etc/do-dyndns/config.json
+
+ENVIRONMENT
+    DYNDNS_CONFIG_FILE      the config file, as with --config
+    DYNDNS_CONFIG_JSON      the whole config, as JSON, instead of a file
+    DYNDNS_IDENTITY_FILE    the age identity file, as with --identity
+    DYNDNS_RECORDS          the records, as TYPE:SUBDOMAIN separated by commas,
+                            instead of those of the config file, if any
+    DYNDNS_TOKEN, DYNDNS_PROVIDER, DYNDNS_TTL
+                            the token, provider and TTL, instead of those of
+                            the config file
 `
 
+// Record is a DNS record to set, identified either by a fully qualified
+// subdomain, or by a record name and a domain.
 type Record struct {
 	Type      string `json:"type"`
 	Subdomain string `json:"subdomain"`
+	Name      string `json:"name"`
+	Domain    string `json:"domain"`
+	Provider  string `json:"provider"`
+	Proxied   bool   `json:"proxied"`
+	// Data is the content of records of StaticTypes, which don't track the
+	// public IP address, e.g. the text of TXT records.
+	Data string `json:"data"`
+	// Target, Priority, Weight and Port make up the data of SRV records, and
+	// Target and Priority that of MX records, if not given in Data.
+	Target   string `json:"target"`
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+	// TTL is the TTL of the record, in seconds, or 0 for the global one.
+	TTL int `json:"ttl"`
+	// IPv6Suffix, if set, replaces the host part of the detected IPv6
+	// address, after the first PrefixLength bits (64 by default), to set
+	// AAAA records for other hosts in the same network.
+	IPv6Suffix   string `json:"ipv6_suffix"`
+	PrefixLength int    `json:"prefix_length"`
+	// Interface or BindAddress bind the record to an uplink, on multi-WAN
+	// hosts: its address is read from the network interface, or detected
+	// from the local address, independently of other records.
+	Interface   string `json:"interface"`
+	BindAddress string `json:"bind_address"`
+	// IP, or IPSourceURL, IPSourceField and IPSources, are IP sources of the
+	// record's own, replacing those of the config: its given addresses, as
+	// with --ip, or the detectors to try in order. AllowPrivate, if set,
+	// replaces "allow_private", e.g. to publish a VPN address.
+	IP            string   `json:"ip"`
+	IPSourceURL   string   `json:"ip_source_url"`
+	IPSourceField string   `json:"ip_source_field"`
+	IPSources     []string `json:"ip_sources"`
+	AllowPrivate  *bool    `json:"allow_private"`
+	// Token, or the named token in the "credentials" of the config file,
+	// sets the record with another account or team of its provider.
+	Token      string `json:"token"`
+	Credential string `json:"credential"`
+	// Enabled, if false, parks the record: it stays in the config file, but
+	// is not set, e.g. while its host is offline.
+	Enabled *bool `json:"enabled"`
+}
+
+// enabled reports whether the record is set, unless parked.
+func (r Record) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// account returns the key of the provider of the record in Providers: its
+// name, along with its own token if any.
+func (r Record) account() string {
+	if r.Token == "" {
+		return r.Provider
+	}
+
+	return r.Provider + " " + r.Token
+}
+
+// StaticTypes are the record types whose data is given in the config file,
+// set along with the dynamic A and AAAA records.
+var StaticTypes = map[string]bool{"TXT": true, "CNAME": true, "SRV": true, "MX": true}
+
+// staticData returns the data of a record of StaticTypes: Data, or else the
+// fields of SRV and MX records, in zone file order.
+func (r Record) staticData(recordType string) (string, error) {
+	switch {
+	case r.Data != "":
+		return r.Data, nil
+	case recordType == "MX" && r.Target != "":
+		return joinData([]int{r.Priority}, r.Target), nil
+	case recordType == "MX":
+		return "", fmt.Errorf("missing target for %s", r)
+	case recordType != "SRV":
+		return "", fmt.Errorf("missing data for %s", r)
+	case r.Target == "" || r.Port == 0:
+		return "", fmt.Errorf("missing target or port for %s", r)
+	}
+
+	return joinData([]int{r.Priority, r.Weight, r.Port}, r.Target), nil
+}
+
+// split returns the record name and domain of a record. If only the subdomain
+// is given, it is split at the first dot, unless it has just one and is a
+// domain itself, whose record name is "@"; see Zones.split for a better guess.
+// A wildcard "*" can only be the first label of the subdomain.
+func (r Record) split() (name, domain string, err error) {
+	if r.Domain != "" {
+		if !validName(strings.TrimSuffix(r.Domain, ".")) {
+			return "", "", fmt.Errorf("invalid domain, %s", r.Domain)
+		} else if r.Name != "" && r.Name != "@" && !validName(r.Name) {
+			return "", "", fmt.Errorf("invalid record name, %s", r.Name)
+		}
+
+		if r.Name == "" {
+			return "@", r.Domain, nil
+		}
+
+		return r.Name, r.Domain, nil
+	}
+
+	subdomain := strings.TrimSuffix(r.Subdomain, ".")
+
+	i := strings.Index(subdomain, ".")
+	if i <= 0 || i == len(subdomain)-1 || !validName(subdomain) {
+		return "", "", fmt.Errorf("invalid subdomain, %s", r.Subdomain)
+	}
+
+	if strings.Count(subdomain, ".") == 1 && subdomain[0] != '*' {
+		return "@", subdomain, nil
+	}
+
+	return subdomain[:i], subdomain[i+1:], nil
+}
+
+// validName reports whether name is a valid DNS name: labels of up to 63
+// letters, digits, hyphens, not at their ends, or underscores, as in
+// "_acme-challenge", and a "*" wildcard as the first label.
+func validName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for i, label := range strings.Split(name, ".") {
+		if label == "*" && i == 0 {
+			continue
+		}
+
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			if c != '-' && c != '_' && c < utf8.RuneSelf && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Zones caches the domains of each provider, to find the zone that each
+// subdomain belongs to. Providers that can't list their domains have none.
+type Zones map[Provider][]string
+
+// split returns the record name and domain of a record whose subdomain is
+// valid. The domain is the longest of the domains of provider that the
+// subdomain is in, listed within timeout, so that "nas.home.example.com" is
+// "nas.home" in "example.com", and a subdomain that is one of the domains is
+// "@". Otherwise it is split like Record.split.
+func (z Zones) split(provider Provider, r Record, timeout time.Duration) (name, domain string) {
+	name, domain, _ = r.split()
+	if r.Domain != "" || z == nil {
+		return name, domain
+	}
+
+	domains, ok := z[provider]
+	if !ok {
+		if lister, isLister := provider.(DomainLister); isLister {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			domains, _ = lister.Domains(ctx)
+
+			cancel()
+		}
+
+		z[provider] = domains
+	}
+
+	subdomain := strings.ToLower(strings.TrimSuffix(r.Subdomain, "."))
+	best := ""
+
+	for _, zone := range domains {
+		if subdomain == strings.ToLower(zone) {
+			return "@", zone
+		}
+
+		if strings.HasSuffix(subdomain, "."+strings.ToLower(zone)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+
+	if best == "" {
+		return name, domain
+	}
+
+	return strings.TrimSuffix(r.Subdomain, ".")[:len(subdomain)-len(best)-1], best
+}
+
+// uplink describes the uplink a record is bound to, and its own IP
+// sources, or returns an empty string if none. Records of the same uplink
+// share the detection.
+func (r Record) uplink() string {
+	var parts []string
+
+	if source := r.ipSource(); r.Interface != "" {
+		parts = append(parts, "interface "+r.Interface)
+	} else if source != "" {
+		parts = append(parts, source)
+	}
+
+	if r.BindAddress != "" && r.Interface == "" && r.IP == "" {
+		parts = append(parts, "address "+r.BindAddress)
+	}
+
+	if r.AllowPrivate != nil {
+		parts = append(parts, fmt.Sprintf("allow_private %t", *r.AllowPrivate))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// ipSource describes the IP sources of the record's own, or returns an
+// empty string if none.
+func (r Record) ipSource() string {
+	if r.IP != "" {
+		return "given address " + r.IP
+	}
+
+	sources := r.IPSources
+
+	if r.IPSourceURL != "" {
+		url := r.IPSourceURL
+		if r.IPSourceField != "" {
+			url += " (" + r.IPSourceField + ")"
+		}
+
+		sources = append([]string{url}, sources...)
+	}
+
+	if len(sources) == 0 {
+		return ""
+	}
+
+	return "IP source " + strings.Join(sources, ", ")
+}
+
+// String returns the fully qualified name of a record.
+func (r Record) String() string {
+	if r.Domain == "" {
+		return r.Subdomain
+	}
+
+	if r.Name == "" || r.Name == "@" {
+		return r.Domain
+	}
+
+	return r.Name + "." + r.Domain
+}
+
+// TimeoutsConfig is the "timeouts" section of the config file, with
+// durations like "30s".
+type TimeoutsConfig struct {
+	// Detect is how long to wait for each IP source.
+	Detect string `json:"detect"`
+	// API is how long to wait for the provider API calls to set each
+	// record.
+	API string `json:"api"`
+	// Healthcheck is how long to wait for the monitoring URL.
+	Healthcheck string `json:"healthcheck"`
+}
+
+// parseTimeout parses the timeout of a phase, or returns fallback if text is
+// empty.
+func parseTimeout(phase, text string, fallback time.Duration) (time.Duration, error) {
+	if text == "" {
+		return fallback, nil
+	}
+
+	timeout, err := time.ParseDuration(text)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s timeout, %s", phase, text)
+	}
+
+	return timeout, nil
+}
+
+// RecordDefaults is the "defaults" section of the config file, the
+// settings that records inherit unless they have their own.
+type RecordDefaults struct {
+	Type     string `json:"type"`
+	TTL      int    `json:"ttl"`
+	Provider string `json:"provider"`
+	// IPSourceURL, IPSourceField and IPSources are the IP sources of the
+	// records without an interface or IP sources of their own.
+	IPSourceURL   string   `json:"ip_source_url"`
+	IPSourceField string   `json:"ip_source_field"`
+	IPSources     []string `json:"ip_sources"`
+}
+
+// apply returns record with the defaults for the settings it lacks.
+func (d RecordDefaults) apply(record Record) Record {
+	if record.Type == "" {
+		record.Type = d.Type
+	}
+
+	if record.TTL == 0 {
+		record.TTL = d.TTL
+	}
+
+	if record.Provider == "" {
+		record.Provider = d.Provider
+	}
+
+	if record.Interface == "" && record.ipSource() == "" {
+		record.IPSourceURL, record.IPSourceField, record.IPSources = d.IPSourceURL, d.IPSourceField, d.IPSources
+	}
+
+	return record
 }
 
 // Config is the configuration file format.
 type Config struct {
-	Log     string   `json:"log"`
-	Token   string   `json:"token"`
-	Records []Record `json:"records"`
+	Log   string `json:"log"`
+	Token string `json:"token"`
+	// TokenFile, if set, is a file with the token instead, such as a
+	// systemd credential or a Docker secret.
+	TokenFile string `json:"token_file"`
+	// TokenCmd, if set, is a shell command that prints the token instead,
+	// such as that of a password manager.
+	TokenCmd string `json:"token_cmd"`
+	// TokenSource, if TokenSourceKeyring, gets the token from the system
+	// keyring instead, if TokenSourceVault, from Vault, and if
+	// TokenSourceAWS, from AWS Secrets Manager or SSM Parameter Store.
+	TokenSource string   `json:"token_source"`
+	Provider    string   `json:"provider"`
+	Duplicates  string   `json:"duplicates"`
+	Prefer      string   `json:"prefer"`
+	Records     []Record `json:"records"`
+	// Credentials are named tokens of DigitalOcean, Cloudflare, Gandi or
+	// DuckDNS, for records of other accounts or teams.
+	Credentials map[string]string `json:"credentials"`
+	// Profiles are named sets of settings, in the same format, that replace
+	// those above as chosen with --profile.
+	Profiles map[string]json.RawMessage `json:"profiles"`
+	// TTL is the TTL of records without their own, in seconds, or 0 to
+	// leave it to each provider.
+	TTL int `json:"ttl"`
+	// Defaults are the settings of records without their own, before the
+	// global Provider and TTL.
+	Defaults RecordDefaults `json:"defaults"`
+
+	// IPSourceURL is a custom public IP address detection service, which
+	// answers with the address in plain text, or in the IPSourceField of a
+	// JSON object if set.
+	IPSourceURL   string `json:"ip_source_url"`
+	IPSourceField string `json:"ip_source_field"`
+	// IPSources are the names of built-in detectors in DetectorCatalogue,
+	// tried in order after IPSourceURL.
+	IPSources []string `json:"ip_sources"`
+	// IPConsensus, if more than 1, is how many IP sources must agree on
+	// the address.
+	IPConsensus int `json:"ip_consensus"`
+	// Interface is a network interface to read the public IP address from,
+	// instead of asking IP sources.
+	Interface string `json:"interface"`
+	// AllowPrivate allows publishing private, CGNAT and other addresses that
+	// cannot be reached from the internet, e.g. for names in the LAN.
+	AllowPrivate bool `json:"allow_private"`
+	// AllowedRanges are the networks, in CIDR notation, that addresses must
+	// be in to be published, e.g. the prefixes of the ISP.
+	AllowedRanges []string `json:"allowed_ranges"`
+	// Proxy is the URL of the HTTP, HTTPS or SOCKS5 proxy for web IP sources
+	// and provider APIs, instead of HTTP_PROXY and HTTPS_PROXY.
+	Proxy string `json:"proxy"`
+	// Timeouts bound each phase of a run.
+	Timeouts TimeoutsConfig `json:"timeouts"`
+	// DetectRetry is how to retry when the public IP address is not found,
+	// and APIRetry failed provider API requests.
+	DetectRetry RetryConfig `json:"detect_retry"`
+	APIRetry    RetryConfig `json:"api_retry"`
+	// StateMaxAge is how long to trust the state of the records as last set,
+	// as a duration; "0s" always asks the providers.
+	StateMaxAge string `json:"state_max_age"`
+	// DNSPrecheck is the DNS server asked whether records already have the
+	// address, before calling their providers, or "authoritative" for the
+	// name servers of their domains.
+	DNSPrecheck string `json:"dns_precheck"`
+	// PruneOtherFamily deletes the records of the other address family of
+	// records of a single family, e.g. old AAAA records of A records.
+	PruneOtherFamily bool `json:"prune_other_family"`
+
+	MikroTik MikroTikConfig `json:"mikrotik"`
+	OPNsense OPNsenseConfig `json:"opnsense"`
+	PfSense  PfSenseConfig  `json:"pfsense"`
+
+	Cloudflare CloudflareConfig `json:"cloudflare"`
+	Route53    Route53Config    `json:"route53"`
+	Hetzner    HetznerConfig    `json:"hetzner"`
+	Gandi      GandiConfig      `json:"gandi"`
+	Linode     LinodeConfig     `json:"linode"`
+	Vultr      VultrConfig      `json:"vultr"`
+	Namecheap  NamecheapConfig  `json:"namecheap"`
+	Porkbun    PorkbunConfig    `json:"porkbun"`
+	DeSEC      DeSECConfig      `json:"desec"`
+	OVH        OVHConfig        `json:"ovh"`
+	Google     GoogleConfig     `json:"google"`
+	RFC2136    RFC2136Config    `json:"rfc2136"`
+	DynDNS2    DynDNS2Config    `json:"dyndns2"`
+	DuckDNS    DuckDNSConfig    `json:"duckdns"`
+
+	// Vault and AWS are where the tokens of TokenSourceVault and
+	// TokenSourceAWS are kept.
+	Vault VaultConfig     `json:"vault"`
+	AWS   AWSSecretConfig `json:"aws"`
+	// vault reads the token of TokenSourceVault, again in daemon mode.
+	vault *Vault
+}
+
+// Duplicates policies, for subdomains with several records of the same type.
+const (
+	// DuplicatesWarn sets only the first record and warns about the others.
+	DuplicatesWarn = "warn"
+	// DuplicatesUpdate sets all the records to the same IP address.
+	DuplicatesUpdate = "update"
+	// DuplicatesDelete keeps one record, with the IP address if any, and
+	// deletes the others.
+	DuplicatesDelete = "delete"
+)
+
+// Policy controls how existing records are set.
+type Policy struct {
+	// Duplicates decides what to do with several matching records.
+	Duplicates string
+	// Verify re-fetches the records after setting them.
+	Verify bool
+	// Timeout bounds the provider API calls to set each record.
+	Timeout time.Duration
+	// State, if not nil, remembers the records as last set, to skip those
+	// that need no change.
+	State *State
+	// Precheck, if not empty, is the DNS server asked first whether
+	// records need a change, or PrecheckAuthoritative.
+	Precheck string
+	// Force rewrites records even if they are already as they should be,
+	// without asking the state or Precheck first.
+	Force bool
+	// PruneOtherFamily deletes the records of the other address family of
+	// records set to a single family.
+	PruneOtherFamily bool
+	// Zones are the domains of the providers, to find the zone of each
+	// subdomain.
+	Zones Zones
+}
+
+// Options are the command line options.
+type Options struct {
+	Command       string
+	Help          bool
+	Version       bool
+	ListDomains   bool
+	Prepare       bool
+	Dedupe        bool
+	Profile       string
+	IPv4          bool
+	IPv6          bool
+	JSON          bool
+	All           bool
+	Online        bool
+	From          string
+	BindAddress   string
+	BindInterface string
+	Interface     string
+	IPs           listFlag
+	IPFrom        string
+
+	HealthcheckURL  string
+	HealthcheckFail bool
+
+	LogTarget string
+
+	ConfigFile     string
+	IdentityFile   string
+	TokenFile      string
+	NoLegacyConfig bool
+	ReadOnly       bool
+
+	Type       string
+	Subdomains subdomainFlag
+	RecordName string
+	Domain     string
+
+	Verify bool
+	Force  bool
+
+	Daemon        bool
+	Interval      time.Duration
+	ClampInterval bool
+	WatchConfig   bool
+}
+
+// listFlag is a command line option that can be repeated.
+type listFlag []string
+
+// String returns the values of the option.
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds a value of the option.
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+
+	return nil
+}
+
+// subdomainFlag is the --subdomain option, which can be repeated, with the
+// records to set.
+type subdomainFlag []Record
+
+// String returns the subdomains of the option.
+func (s *subdomainFlag) String() string {
+	subdomains := make([]string, 0, len(*s))
+	for _, record := range *s {
+		subdomains = append(subdomains, record.Subdomain)
+	}
+
+	return strings.Join(subdomains, ",")
+}
+
+// Set adds a subdomain, of the type given by a later --type, if any.
+func (s *subdomainFlag) Set(value string) error {
+	*s = append(*s, Record{Subdomain: value})
+
+	return nil
+}
+
+// typeFlag is the --type option, which sets the type of the --subdomain
+// before it, or if given first, that of all the records.
+type typeFlag struct {
+	fallback   *string
+	subdomains *subdomainFlag
+}
+
+// String returns the type of all the records.
+func (t typeFlag) String() string {
+	if t.fallback == nil {
+		return ""
+	}
+
+	return *t.fallback
+}
+
+// Set sets the type of the last subdomain, or of all the records.
+func (t typeFlag) Set(value string) error {
+	if n := len(*t.subdomains); n > 0 {
+		(*t.subdomains)[n-1].Type = value
+	} else {
+		*t.fallback = value
+	}
+
+	return nil
 }
 
+// Log targets, where messages are written to.
+const (
+	LogTargetStdout = "stdout"
+	LogTargetFile   = "file"
+	LogTargetSyslog = "syslog"
+)
+
+// Journal priority prefixes, which the systemd journal takes the priority of
+// each line of a service from, as in sd-daemon(3).
+const (
+	JournalErr     = "<3>"
+	JournalWarning = "<4>"
+	JournalInfo    = "<6>"
+)
+
 // Global variables describing the environment do-dyndns is running in.
 var (
 	tty     = isatty()
 	systemd = isSystemdService()
+	// journalOut and journalErr are whether stdout and stderr are connected
+	// to the systemd journal.
+	journalOut = isJournalStream(os.Stdout)
+	journalErr = isJournalStream(os.Stderr)
 )
 
+// logTarget is where writeOut and writeErr send their messages.
+// By default, messages go to stdout in a terminal and under systemd, and
+// to the log file otherwise (e.g. for a cron job).
+var logTarget = defaultLogTarget()
+
+// syslogWriter is the connection to the system logger, if used.
+var syslogWriter *syslog.Writer
+
+// healthcheckFailURL is pinged by die, if set.
+var healthcheckFailURL string
+
+// healthcheckTimeout bounds the time spent pinging a monitoring URL.
+var healthcheckTimeout = HealthcheckTimeout
+
 // isatty returns true if stdout is a terminal.
 func isatty() bool {
 	_, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
@@ -77,26 +785,84 @@ func isSystemdService() bool {
 	return ok
 }
 
-// writeOut writes to stdout or the log file, depending on the environment.
-func writeOut(text string) {
+// isJournalStream returns true if file is connected to the systemd journal,
+// as systemd tells services in JOURNAL_STREAM.
+func isJournalStream(file *os.File) bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	if stream == "" {
+		return false
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return false
+	}
+
+	return stream == fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
+
+// withPriority prefixes each line of text with the journal priority, so that
+// continuation lines are not taken as informational.
+func withPriority(priority, text string) string {
+	return priority + strings.ReplaceAll(text, "\n", "\n"+priority)
+}
+
+// defaultLogTarget returns the log target for the environment.
+func defaultLogTarget() string {
 	if tty || systemd {
+		return LogTargetStdout
+	}
+
+	return LogTargetFile
+}
+
+// writeOut writes to stdout, the log file or syslog, depending on the log target.
+func writeOut(text string) {
+	switch logTarget {
+	case LogTargetStdout:
+		if journalOut {
+			text = withPriority(JournalInfo, text)
+		}
+
 		_, err := fmt.Fprintln(os.Stdout, text)
 		if err != nil {
 			return
 		}
-	} else {
+	case LogTargetSyslog:
+		_ = syslogWriter.Info(text)
+	default:
 		mlog.Info(text)
 	}
 }
 
-// writeErr writes to stderr or the log file, depending on the environment.
+// writeErr writes to stderr, the log file or syslog, depending on the log target.
 func writeErr(text string) {
-	if tty || systemd {
+	writeErrPriority(JournalWarning, text)
+}
+
+// writeErrPriority is like writeErr, with the priority of the message in the
+// systemd journal, if stderr is connected to it, or in syslog.
+func writeErrPriority(priority, text string) {
+	switch logTarget {
+	case LogTargetStdout:
+		if journalErr {
+			text = withPriority(priority, text)
+		}
+
 		_, err := fmt.Fprintln(os.Stderr, text)
 		if err != nil {
 			return
 		}
-	} else {
+	case LogTargetSyslog:
+		switch priority {
+		case JournalErr:
+			_ = syslogWriter.Err(text)
+		case JournalInfo:
+			_ = syslogWriter.Info(text)
+		default:
+			_ = syslogWriter.Warning(text)
+		}
+	default:
 		mlog.Warning(text)
 	}
 }
@@ -104,14 +870,67 @@ func writeErr(text string) {
 // die writes an error message to stderr or the log file and then exits.
 func die(text string, err error) {
 	if err != nil {
-		writeErr(fmt.Sprintf("%s: %s; %s", Prog, text, err))
+		writeErrPriority(JournalErr, fmt.Sprintf("%s: %s; %s", Prog, text, err))
 	} else {
-		writeErr(fmt.Sprintf("%s: %s", Prog, text))
+		writeErrPriority(JournalErr, fmt.Sprintf("%s: %s", Prog, text))
+	}
+
+	if healthcheckFailURL != "" {
+		pingHealthcheck(healthcheckFailURL)
 	}
 
 	os.Exit(1)
 }
 
+// dieConfig writes the problems of an invalid config, one by one as validate
+// does, and exits, or dies of any other error reading it.
+func dieConfig(err error) {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		die("error reading configuration", err)
+	}
+
+	for _, problem := range configErr.Problems {
+		writeErr(fmt.Sprintf("%s: %s: %s", Prog, configErr.File, problem))
+	}
+
+	die("invalid configuration", nil)
+}
+
+// pingHealthcheck sends a GET request to a monitoring URL.
+// Failures are logged, but otherwise ignored.
+func pingHealthcheck(url string) {
+	client := newAPIClient()
+	client.Timeout = healthcheckTimeout
+
+	resp, err := client.Get(url)
+	if err != nil {
+		writeErr(fmt.Sprintf("%s: error pinging healthcheck; %s", Prog, err))
+
+		return
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		writeErr(fmt.Sprintf("%s: error pinging healthcheck; %s", Prog, resp.Status))
+	}
+}
+
+// reportHealth pings url after a successful run, or healthcheckFailURL
+// after a failed one. It does nothing if url is empty.
+func reportHealth(url string, ok bool) {
+	if url == "" {
+		return
+	}
+
+	if ok {
+		pingHealthcheck(url)
+	} else if healthcheckFailURL != "" {
+		pingHealthcheck(healthcheckFailURL)
+	}
+}
+
 // initLogger initializes mlog.
 func initLogger(logfile string) (err error) {
 	var logDir string
@@ -143,211 +962,1686 @@ func initLogger(logfile string) (err error) {
 	return nil
 }
 
-// readConfig reads the configuration file.
-func readConfig() (config Config, err error) {
-	var userHomeDir string
+// initSyslog connects to the system logger.
+func initSyslog() (err error) {
+	syslogWriter, err = syslog.New(syslog.LOG_INFO|syslog.LOG_USER, Prog)
 
-	userHomeDir, err = os.UserHomeDir()
-	if err != nil {
-		return config, err
-	}
+	return err
+}
 
-	// userConfigDir is $HOME/.config on Linux.
-	var userConfigDir string
+// readConfig reads the configuration file, file if not empty, and returns it
+// along with its path. Without a file, the config can be given in the
+// environment, and then the name of the variable is returned as the path.
+func readConfig(file string, noLegacy bool, identity string) (config Config, configFile string, err error) {
+	var content []byte
 
-	userConfigDir, err = os.UserConfigDir()
-	if err != nil {
-		return config, err
-	}
+	switch {
+	case file != "":
+		configFile = file
+	case os.Getenv(ConfigJSONEnv) != "":
+		configFile, content = ConfigJSONEnv, []byte(os.Getenv(ConfigJSONEnv))
+	default:
+		if configFile, err = findConfig(noLegacy); err != nil {
+			if os.Getenv(RecordsEnv) == "" {
+				return config, configFile, err
+			}
 
-	// Create the config directory if it doesn't exist.
-	configDir := filepath.Join(userConfigDir, Prog)
-	if _, err = os.Stat(configDir); err != nil {
-		if err = os.MkdirAll(configDir, 0755); err != nil {
-			return config, err
+			// The records, and the other settings, are in the environment.
+			configFile, content, err = RecordsEnv, []byte("{}"), nil
 		}
 	}
 
-	// Look for the config file in the config directory.
-	configFile := filepath.Join(configDir, ConfigFile)
-	if _, err = os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
-		// If it doesn't exist, look for the old style config file in $HOME.
-		configFile = filepath.Join(userHomeDir, DotConfigFile)
-		if _, err = os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
-			return config, errors.New("unable to find config file")
+	if content == nil {
+		content, err = os.ReadFile(configFile)
+		if err != nil {
+			return config, configFile, err
 		}
 	}
 
-	var content []byte
-
-	content, err = os.ReadFile(configFile)
+	// Encrypted config files are decrypted in memory, never written.
+	content, name, err := decryptConfig(content, configFile, identity)
 	if err != nil {
-		return config, err
+		return config, configFile, err
+	}
+
+	// YAML and TOML are read as the JSON they convert to, with the same
+	// settings.
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if content, err = yamlToJSON(content); err != nil {
+			return config, configFile, err
+		}
+	case ".toml":
+		if content, err = tomlToJSON(content); err != nil {
+			return config, configFile, err
+		}
 	}
 
-	// Substitute $HOME with the actual home directory
-	content = []byte(os.ExpandEnv(string(content)))
+	// Substitute $HOME with the actual home directory, and other variables.
+	if content, err = expandEnv(content); err != nil {
+		return config, configFile, err
+	}
+
+	// Unknown fields are mistakes, such as typos, rather than settings to
+	// ignore.
+	if problems := checkConfigFields(content); len(problems) > 0 {
+		return config, configFile, &ConfigError{File: configFile, Problems: problems}
+	}
 
 	// Parse the JSON data in config file.
 	err = json.Unmarshal(content, &config)
 	if err != nil {
-		return config, err
+		return config, configFile, err
 	}
 
-	return config, err
+	return config, configFile, err
 }
 
-// myPublicIP returns the public IPv4 address of the machine.
-func myPublicIP() (ip net.IP, err error) {
-	resp, err := http.Get("https://api4.ipify.org")
-
-	if err != nil {
-		return nil, err
+// loadConfig reads the config file, or the environment, chosen by the
+// options, with the settings of the chosen profile and environment.
+func loadConfig(options Options) (config Config, configFile string, err error) {
+	if config, configFile, err = readConfig(options.ConfigFile, options.NoLegacyConfig, options.IdentityFile); err != nil {
+		return config, configFile, err
 	}
 
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(resp.Body)
-
-	body, err := io.ReadAll(resp.Body)
-
-	ip = net.ParseIP(string(body))
-	if ip == nil {
-		err = errors.New("no IPv4 found")
+	if options.Profile != "" {
+		if err = config.useProfile(options.Profile); err != nil {
+			return config, configFile, err
+		}
 	}
 
-	return ip, err
-}
-
-// setSubdomainIP sets the IP address of a subdomain.
-func setSubdomainIP(client *godo.Client, recordType string, subdomain string, ip net.IP) (*godo.Response, error) {
-	i := strings.Index(subdomain, ".")
-	if i < 0 {
-		die(fmt.Sprintf("invalid subdomain, %s", subdomain), nil)
+	if err = config.useEnv(); err != nil {
+		return config, configFile, err
 	}
 
-	name := subdomain[:i]
-	domain := subdomain[i+1:]
+	if options.TokenFile != "" {
+		config.TokenFile = options.TokenFile
+	}
 
-	ctx := context.TODO()
+	return config, configFile, nil
+}
 
-	// Get the existing DNS records to avoid creating duplicates.
-	records, _, err := client.Domains.Records(ctx, domain, &godo.ListOptions{})
-	if err != nil {
-		return nil, err
+// selectRecords replaces the records of the config with those given in the
+// options, if any, and leaves out the parked ones, so that a run checks and
+// sets only its own records.
+func (c *Config) selectRecords(options Options) error {
+	// Records given on the command line replace the configured ones.
+	if options.Domain != "" {
+		c.Records = []Record{{Type: options.Type, Name: options.RecordName, Domain: options.Domain}}
+	} else if options.RecordName != "" {
+		return errors.New("missing domain for record name")
+	} else if len(options.Subdomains) > 0 {
+		c.Records = append([]Record(nil), options.Subdomains...)
+
+		for i := range c.Records {
+			if c.Records[i].Type == "" {
+				c.Records[i].Type = options.Type
+			}
+		}
 	}
 
-	var resp *godo.Response
+	// Parked records are left out of the run.
+	records := make([]Record, 0, len(c.Records))
 
-	for _, record := range records {
-		if record.Type == recordType && record.Name == name {
-			if record.Data != ip.String() {
-				// Update an existing DNS record.
-				_, resp, err = client.Domains.EditRecord(ctx, domain, record.ID, &godo.DomainRecordEditRequest{
-					Type: recordType,
-					Name: name,
-					Data: ip.String(),
-				})
-
-				return resp, err
-			} else {
-				// Do nothing if the IP address is the same.
-				return nil, nil
-			}
+	for _, record := range c.Records {
+		if record.enabled() {
+			records = append(records, record)
 		}
 	}
 
-	// Create a new DNS record.
-	_, resp, err = client.Domains.CreateRecord(ctx, domain, &godo.DomainRecordEditRequest{
-		Type: recordType,
-		Name: name,
-		Data: ip.String(),
-	})
+	c.Records = records
 
-	return resp, err
+	return nil
 }
 
-// setSubdomainRecords sets the IP address of multiple subdomains.
-func setSubdomainRecords(token string, records *[]Record, ip net.IP) {
-	client := godo.NewFromToken(token)
+// resolve sets the defaults of the config, the settings given in the
+// options, and the global settings of the records without their own, and
+// checks them. The records are selected before, with selectRecords.
+func (c *Config) resolve(options Options) error {
+	if c.Provider == "" {
+		c.Provider = ProviderDigitalOcean
+	}
 
-	var resp *godo.Response
+	switch {
+	case options.Dedupe:
+		c.Duplicates = DuplicatesDelete
+	case c.Duplicates == "":
+		c.Duplicates = DuplicatesWarn
+	case c.Duplicates != DuplicatesWarn && c.Duplicates != DuplicatesUpdate && c.Duplicates != DuplicatesDelete:
+		return fmt.Errorf("invalid duplicates policy, %s", c.Duplicates)
+	}
 
-	var err error
+	// Records use the defaults, then the global provider, token and TTL,
+	// unless they have their own.
+	for i := range c.Records {
+		c.Records[i] = c.Defaults.apply(c.Records[i])
 
-	for _, record := range *records {
-		if record.Type != "A" && record.Type != "AAAA" {
-			die(fmt.Sprintf("invalid type, %s", record.Type), nil)
+		if c.Records[i].Provider == "" {
+			c.Records[i].Provider = c.Provider
 		}
 
-		if record.Subdomain == "" {
-			die("missing subdomain", nil)
+		if c.Records[i].TTL == 0 {
+			c.Records[i].TTL = c.TTL
 		}
 
-		resp, err = setSubdomainIP(client, record.Type, record.Subdomain, ip)
-		if err != nil {
-			die("error setting subdomain IP", err)
+		if name := c.Records[i].Credential; name != "" {
+			token, ok := c.Credentials[name]
+			if !ok {
+				return fmt.Errorf("unknown credential of %s, %s", c.Records[i], name)
+			}
+
+			c.Records[i].Token = token
 		}
 
-		if resp != nil {
-			writeOut(fmt.Sprintf("%s: set %s %s for %s", resp.Status, record.Type, ip.String(), record.Subdomain))
+		if c.Records[i].TTL < 0 {
+			return fmt.Errorf("invalid TTL of %s, %d", c.Records[i], c.Records[i].TTL)
 		}
 	}
-}
 
-func parseArguments() (bool, bool) {
-	var help, version bool
+	if c.Prefer == "" {
+		c.Prefer = PreferIPv4
+	} else if c.Prefer != PreferIPv4 && c.Prefer != PreferIPv6 {
+		return fmt.Errorf("invalid address family preference, %s", c.Prefer)
+	}
 
-	flag.BoolVar(&help, "h", false, "")
-	flag.BoolVar(&help, "help", false, "")
-	flag.BoolVar(&version, "v", false, "")
-	flag.BoolVar(&version, "version", false, "")
-	flag.Parse()
+	if options.Interface != "" {
+		c.Interface = options.Interface
+	}
 
-	return help, version
+	return nil
 }
 
-// RUN.
-func main() {
-	help, version := parseArguments()
-	if help {
-		_, err := fmt.Fprintf(os.Stderr, Usage, Prog, Prog)
-		if err != nil {
-			os.Exit(1)
-		}
+// envVariable matches the environment variables in config values: $VAR,
+// ${VAR}, or $$ for a dollar sign.
+var envVariable = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
 
-		os.Exit(0)
-	} else if version {
-		_, err := fmt.Fprintf(os.Stderr, "%s %s\n", Prog, Version)
-		if err != nil {
-			os.Exit(1)
-		}
+// expandEnv replaces the environment variables in the string values of the
+// JSON content with their values, so that secrets such as tokens can be
+// given in the environment, whatever the characters in them. Variables in
+// braces must be set, so that a missing secret is not taken as empty.
+func expandEnv(content []byte) ([]byte, error) {
+	var value interface{}
 
-		os.Exit(0)
-	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
 
-	config, err := readConfig()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("invalid data after the end of the config")
+	}
+
+	var undefined []string
+
+	missing := map[string]bool{}
+	expand := func(text string) string {
+		return envVariable.ReplaceAllStringFunc(text, func(variable string) string {
+			if variable == "$$" {
+				return "$"
+			}
+
+			match := envVariable.FindStringSubmatch(variable)
+			if match[1] == "" {
+				return os.Getenv(match[2])
+			}
+
+			envValue, ok := os.LookupEnv(match[1])
+			if !ok && !missing[match[1]] {
+				undefined = append(undefined, match[1])
+				missing[match[1]] = true
+			}
+
+			return envValue
+		})
+	}
+
+	value = expandValues(value, expand)
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf("undefined environment variable, %s", strings.Join(undefined, ", "))
+	}
+
+	return json.Marshal(value)
+}
+
+// expandValues returns value, decoded from JSON, with expand applied to all
+// its strings but the keys of objects.
+func expandValues(value interface{}, expand func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expand(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = expandValues(v[i], expand)
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = expandValues(v[key], expand)
+		}
+	}
+
+	return value
+}
+
+// findConfig returns the path of the configuration file in the user config
+// directory. Unless noLegacy is true, it falls back to the old style config
+// file in $HOME, and then to the system config directories, for system
+// users and services without a home directory of their own.
+func findConfig(noLegacy bool) (string, error) {
+	var configFiles []string
+
+	// userConfigDir is $HOME/.config on Linux.
+	if userConfigDir, err := os.UserConfigDir(); err == nil {
+		configDir := filepath.Join(userConfigDir, Prog)
+
+		for _, name := range ConfigFiles {
+			configFiles = append(configFiles, filepath.Join(configDir, name))
+		}
+	}
+
+	if userHomeDir, err := os.UserHomeDir(); err == nil && !noLegacy {
+		configFiles = append(configFiles, filepath.Join(userHomeDir, DotConfigFile))
+	}
+
+	for _, dir := range systemConfigDirs() {
+		for _, name := range ConfigFiles {
+			configFiles = append(configFiles, filepath.Join(dir, Prog, name))
+		}
+	}
+
+	for _, configFile := range configFiles {
+		if _, err := os.Stat(configFile); !errors.Is(err, os.ErrNotExist) {
+			return configFile, nil
+		}
+	}
+
+	return "", errors.New("unable to find config file")
+}
+
+// warnLegacyConfig warns if configFile, as read with options, is the old style
+// config file in $HOME, found without --config.
+func warnLegacyConfig(options Options, configFile string) {
+	if options.ConfigFile == "" && filepath.Base(configFile) == DotConfigFile {
+		writeErr(fmt.Sprintf("%s: using legacy config file %s", Prog, configFile))
+	}
+}
+
+// systemConfigDirs returns the system config directories, in order:
+// $XDG_CONFIG_DIRS, or else /etc/xdg, and then SystemConfigDir.
+func systemConfigDirs() []string {
+	var dirs []string
+
+	for _, dir := range strings.Split(os.Getenv("XDG_CONFIG_DIRS"), ":") {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if len(dirs) == 0 {
+		dirs = append(dirs, "/etc/xdg")
+	}
+
+	return append(dirs, SystemConfigDir)
+}
+
+// useProfile replaces the settings of the config with those of the profile
+// called name. Settings not in the profile are kept, and records and other
+// lists are replaced as a whole.
+func (c *Config) useProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile, %s", name)
+	}
+
+	return json.Unmarshal(profile, c)
+}
+
+// readToken sets the token of the config from its token file, the output
+// of its token command, the system keyring, Vault or AWS, if any.
+func (c *Config) readToken() error {
+	switch {
+	case c.TokenFile != "":
+		content, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return err
+		}
+
+		if c.Token = strings.TrimSpace(string(content)); c.Token == "" {
+			return fmt.Errorf("empty token file, %s", c.TokenFile)
+		}
+	case c.TokenCmd != "":
+		ctx, cancel := context.WithTimeout(context.Background(), TokenCmdTimeout)
+		defer cancel()
+
+		// The command may ask for a passphrase, on the terminal.
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.TokenCmd) //nolint:gosec // The command is configured.
+		cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+
+		output, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("token command failed; %w", err)
+		}
+
+		if c.Token = strings.TrimSpace(string(output)); c.Token == "" {
+			return errors.New("no token printed by the token command")
+		}
+	case c.TokenSource == TokenSourceKeyring:
+		token, err := keyringGet(KeyringAccount)
+		if err != nil {
+			return err
+		}
+
+		c.Token = token
+	case c.TokenSource == TokenSourceVault:
+		vault, err := newVault(c.Vault)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), APITimeout)
+		defer cancel()
+
+		if c.Token, err = vault.secret(ctx); err != nil {
+			return err
+		}
+
+		c.vault = vault
+	case c.TokenSource == TokenSourceAWS:
+		ctx, cancel := context.WithTimeout(context.Background(), APITimeout)
+		defer cancel()
+
+		token, err := awsSecret(ctx, c.AWS)
+		if err != nil {
+			return err
+		}
+
+		c.Token = token
+	case c.TokenSource != "":
+		return fmt.Errorf("invalid token source, %s", c.TokenSource)
+	}
+
+	return nil
+}
+
+// useEnv overrides the settings of the config with those given in the
+// environment.
+func (c *Config) useEnv() error {
+	if token := os.Getenv(TokenEnv); token != "" {
+		c.Token = token
+	}
+
+	if provider := os.Getenv(ProviderEnv); provider != "" {
+		c.Provider = provider
+	}
+
+	if text := os.Getenv(TTLEnv); text != "" {
+		ttl, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("invalid %s, %s", TTLEnv, text)
+		}
+
+		c.TTL = ttl
+	}
+
+	records := os.Getenv(RecordsEnv)
+	if records == "" {
+		return nil
+	}
+
+	c.Records = nil
+
+	for _, entry := range strings.Split(records, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		recordType, subdomain, found := strings.Cut(entry, ":")
+		if !found {
+			recordType, subdomain = "A", entry
+		}
+
+		c.Records = append(c.Records, Record{Type: strings.TrimSpace(recordType), Subdomain: strings.TrimSpace(subdomain)})
+	}
+
+	return nil
+}
+
+// setSubdomainIP sets the IP address of a subdomain, according to policy.
+// want is the record as it should be, with the IP address as its data.
+// It returns what was done, "created", "updated" or "" if nothing, and the
+// TTL of the record.
+func setSubdomainIP(provider Provider, domain string, want DNSRecord, policy Policy) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	// Get the existing DNS records to avoid creating duplicates.
+	// There may be several of them, e.g. for round-robin DNS.
+	matches, err := provider.Records(ctx, domain, want.Type, want.Name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if len(matches) == 0 {
+		// Create a new DNS record.
+		created, err := provider.CreateRecord(ctx, domain, want)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if policy.Verify {
+			verifyRecord(provider, domain, created, want.Data, policy.Timeout)
+		}
+
+		return "created", created.TTL, nil
+	}
+
+	if len(matches) > 1 {
+		switch policy.Duplicates {
+		case DuplicatesWarn:
+			writeErr(fmt.Sprintf("%s: found %d %s records for %s, setting only the first",
+				Prog, len(matches), want.Type, Record{Name: want.Name, Domain: domain}))
+
+			matches = matches[:1]
+		case DuplicatesDelete:
+			if matches, err = deleteDuplicates(ctx, provider, domain, want, matches); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+
+	var action string
+
+	for _, record := range matches {
+		// Do nothing if the record is already as it should be.
+		if !policy.Force && sameData(want.Type, record.Data, want.Data) && record.Proxied == want.Proxied &&
+			want.hasTTL(record.TTL) {
+			continue
+		}
+
+		// Update an existing DNS record.
+		record.Data = want.Data
+		record.Proxied = want.Proxied
+
+		if want.TTL > 0 {
+			record.TTL = want.TTL
+		}
+
+		if err = provider.UpdateRecord(ctx, domain, record); err != nil {
+			return "", 0, err
+		}
+
+		action = "updated"
+
+		if policy.Verify {
+			verifyRecord(provider, domain, record, want.Data, policy.Timeout)
+		}
+	}
+
+	if want.TTL > 0 {
+		return action, want.TTL, nil
+	}
+
+	return action, matches[0].TTL, nil
+}
+
+// deleteDuplicates deletes all the matches of want but one, the first with
+// its data if any, and returns that one.
+func deleteDuplicates(
+	ctx context.Context, provider Provider, domain string, want DNSRecord, matches []DNSRecord,
+) ([]DNSRecord, error) {
+	keep := 0
+
+	for i, match := range matches {
+		if sameData(want.Type, match.Data, want.Data) {
+			keep = i
+
+			break
+		}
+	}
+
+	for i, match := range matches {
+		if i == keep {
+			continue
+		}
+
+		if err := provider.DeleteRecord(ctx, domain, match); err != nil {
+			return nil, err
+		}
+
+		writeOut(fmt.Sprintf("deleted duplicate %s %s for %s",
+			want.Type, match.Data, Record{Name: want.Name, Domain: domain}))
+	}
+
+	return matches[keep : keep+1], nil
+}
+
+// precheck reports whether record already resolves to the data of want with
+// policy.Precheck, within policy.Timeout.
+func (policy Policy) precheck(record Record, want DNSRecord) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	return precheck(ctx, policy.Precheck, record.String(), want)
+}
+
+// verifyRecord re-fetches a record until it has the expected data, waiting
+// up to timeout for each attempt.
+// If the provider hasn't caught up after VerifyAttempts, it writes a warning.
+// Records are matched by data too, since some providers change the record
+// ID along with it.
+func verifyRecord(provider Provider, domain string, record DNSRecord, want string, timeout time.Duration) {
+	fqdn := Record{Name: record.Name, Domain: domain}
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		records, err := provider.Records(ctx, domain, record.Type, record.Name)
+
+		cancel()
+
+		var data string
+
+		for _, r := range records {
+			if r.ID == record.ID || sameData(record.Type, r.Data, want) {
+				data = r.Data
+			}
+
+			if sameData(record.Type, data, want) {
+				break
+			}
+		}
+
+		if err == nil && sameData(record.Type, data, want) {
+			return
+		}
+
+		if attempt == VerifyAttempts {
+			if err != nil {
+				writeErr(fmt.Sprintf("%s: unable to verify record %s; %s", Prog, fqdn, err))
+			} else {
+				writeErr(fmt.Sprintf("%s: record %s is still %q instead of %q", Prog, fqdn, data, want))
+			}
+
+			return
+		}
+
+		time.Sleep(VerifyDelay)
+	}
+}
+
+// recordWants returns the records to set for a record, as they should be,
+// one for each address family of dual-stack records. It returns false if a
+// family was skipped, because its public IP address is not available.
+func recordWants(record Record, ips PublicIPs) ([]DNSRecord, bool) {
+	recordType := strings.ToUpper(record.Type)
+	if !knownType(recordType) {
+		die(fmt.Sprintf("invalid type, %s", record.Type), nil)
+	}
+
+	if record.Subdomain == "" && record.Domain == "" {
+		die("missing subdomain", nil)
+	}
+
+	if _, _, err := record.split(); err != nil {
+		die(err.Error(), nil)
+	}
+
+	var data string
+
+	var err error
+
+	if StaticTypes[recordType] {
+		if data, err = record.staticData(recordType); err != nil {
+			die(err.Error(), nil)
+		}
+	}
+
+	var wants []DNSRecord
+
+	ok := true
+
+	// Dual-stack records are set once per address family, independently.
+	for _, recordType := range recordTypes(recordType) {
+		if !StaticTypes[recordType] {
+			var ip net.IP
+
+			var ipErr error
+
+			recordType, ip, ipErr = ips.forType(recordType)
+			if ip == nil {
+				writeErr(fmt.Sprintf("%s: no public IP address for %s, skipping %s; %v",
+					Prog, recordType, record, ipErr))
+
+				ok = false
+
+				continue
+			}
+
+			if recordType == "AAAA" && record.IPv6Suffix != "" {
+				base, prefixLength := ip, record.PrefixLength
+
+				// The hosts of the LAN are in the delegated prefix, if
+				// known, rather than in the network of the WAN address.
+				if ips.IPv6Prefix != nil {
+					base = ips.IPv6Prefix.IP
+
+					if prefixLength == 0 {
+						prefixLength, _ = ips.IPv6Prefix.Mask.Size()
+					}
+				}
+
+				if ip, err = withSuffix(base, record.IPv6Suffix, prefixLength); err != nil {
+					die(err.Error(), nil)
+				}
+			}
+
+			data = ip.String()
+		}
+
+		wants = append(wants, DNSRecord{Type: recordType, Data: data, TTL: record.TTL, Proxied: record.Proxied})
+	}
+
+	return wants, ok
+}
+
+// setRecord sets a record as want with set, unless the state or the DNS
+// precheck tell that it already is. It returns false if the record was
+// skipped, its TTL, and the error found, if any, other than its domain not
+// being in the account.
+func setRecord(
+	providers Providers, record Record, want DNSRecord, policy Policy,
+	set func(Provider, string, DNSRecord, Policy) (string, int, error),
+) (bool, int, error) {
+	key := stateKey(record.Provider, record, want)
+
+	// Prepared records keep a low TTL until their address is stable.
+	preparedTTL, prepared, restore := policy.State.preparedTTL(key, want.Data)
+	if prepared {
+		want.TTL = preparedTTL
+	}
+
+	// Records already set as they should be need no API calls.
+	if cachedTTL, cached := policy.State.published(key, want); cached && !policy.Force {
+		if restore {
+			policy.State.restored(key)
+		}
+
+		return true, cachedTTL, nil
+	}
+
+	if policy.Precheck != "" && !policy.Force && !record.Proxied && !prepared && policy.precheck(record, want) {
+		return true, 0, nil
+	}
+
+	var domain string
+
+	want.Name, domain = policy.Zones.split(providers[record.account()], record, policy.Timeout)
+
+	action, ttl, err := set(providers[record.account()], domain, want, policy)
+	policy.State.publish(key, want, ttl, err)
+
+	if errors.Is(err, ErrDomainNotFound) {
+		// Skip records whose domain is not in the account, but keep going.
+		writeErr(fmt.Sprintf("%s: %s, skipping %s", Prog, err, record))
+
+		return false, 0, nil
+	} else if err != nil {
+		writeErr(fmt.Sprintf("%s: error setting subdomain IP for %s; %s", Prog, record, err))
+
+		return false, 0, err
+	}
+
+	if action != "" {
+		writeOut(fmt.Sprintf("%s %s %s for %s", action, want.Type, want.Data, record))
+	}
+
+	if restore {
+		policy.State.restored(key)
+		writeOut(fmt.Sprintf("restored TTL of %s %s to %d", want.Type, record, want.TTL))
+	}
+
+	return true, ttl, nil
+}
+
+// pruneOtherFamily deletes the records of the other address family of a
+// record, with policy.PruneOtherFamily, if it was set to a single family as
+// wants. The state remembers them as deleted, as records with no data.
+// It returns the same values as setRecord, but the TTL.
+func pruneOtherFamily(providers Providers, record Record, wants []DNSRecord, set bool, policy Policy) (bool, error) {
+	if !policy.PruneOtherFamily || !set || len(wants) != 1 || StaticTypes[wants[0].Type] {
+		return true, nil
+	}
+
+	other := DNSRecord{Type: "A"}
+	if wants[0].Type == "A" {
+		other.Type = "AAAA"
+	}
+
+	ok, _, err := setRecord(providers, record, other, policy, deleteRecords)
+
+	return ok, err
+}
+
+// deleteRecords deletes the records of provider in domain with the type and
+// name of want, writing those deleted, so no action is returned.
+func deleteRecords(provider Provider, domain string, want DNSRecord, policy Policy) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	matches, err := provider.Records(ctx, domain, want.Type, want.Name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, match := range matches {
+		if err = provider.DeleteRecord(ctx, domain, match); err != nil {
+			return "", 0, err
+		}
+
+		writeOut(fmt.Sprintf("deleted %s %s for %s", want.Type, match.Data, Record{Name: want.Name, Domain: domain}))
+	}
+
+	return "", 0, nil
+}
+
+// setSubdomainRecords sets the IP address of multiple subdomains.
+// It returns false if any record was skipped, the smallest record TTL, and
+// the first error found; records after an error are still set.
+func setSubdomainRecords(
+	providers Providers, records *[]Record, ips PublicIPs, policy Policy,
+) (ok bool, minTTL int, firstErr error) {
+	ok = true
+
+	for _, record := range *records {
+		wants, recordOK := recordWants(record, ips)
+		ok = ok && recordOK
+
+		for _, want := range wants {
+			wantOK, ttl, err := setRecord(providers, record, want, policy, setSubdomainIP)
+			ok, recordOK = ok && wantOK, recordOK && wantOK
+
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+
+			if ttl > 0 && (minTTL == 0 || ttl < minTTL) {
+				minTTL = ttl
+			}
+		}
+
+		if pruneOK, err := pruneOtherFamily(providers, record, wants, recordOK, policy); err != nil {
+			ok = false
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			ok = ok && pruneOK
+		}
+	}
+
+	return ok, minTTL, firstErr
+}
+
+// update detects the public IP addresses and sets all the records.
+// Records bound to an uplink are detected separately for each uplink, and
+// records of StaticTypes are set without detection.
+// It returns the same values as setSubdomainRecords.
+func update(providers Providers, config *Config, detection Detection, policy Policy) (bool, int, error) {
+	// Domains are listed again on every run, in case they changed.
+	policy.Zones = Zones{}
+
+	sets := roundRobinSets(config.Records)
+
+	var uplinks, setKeys []string
+
+	var static []Record
+
+	groups := map[string][]Record{}
+	members := map[string][]setMember{}
+
+	for _, record := range config.Records {
+		if key := setKey(record); sets[key] {
+			if _, ok := members[key]; !ok {
+				setKeys = append(setKeys, key)
+			}
+
+			members[key] = nil
+		}
+
+		// Records of static types are set even if no address is detected.
+		if StaticTypes[strings.ToUpper(record.Type)] {
+			static = append(static, record)
+
+			continue
+		}
+
+		uplink := record.uplink()
+		if _, ok := groups[uplink]; !ok {
+			uplinks = append(uplinks, uplink)
+		}
+
+		groups[uplink] = append(groups[uplink], record)
+	}
+
+	// Members of round-robin sets are set after all the uplinks are
+	// detected, and the others as they are.
+	singles := func(records []Record, ips PublicIPs) []Record {
+		var rest []Record
+
+		for _, record := range records {
+			if key := setKey(record); sets[key] {
+				members[key] = append(members[key], setMember{record: record, ips: ips})
+			} else {
+				rest = append(rest, record)
+			}
+		}
+
+		return rest
+	}
+
+	static = singles(static, PublicIPs{})
+
+	ok, minTTL, firstErr := setSubdomainRecords(providers, &static, PublicIPs{}, policy)
+	if firstErr != nil {
+		firstErr = fmt.Errorf("error setting subdomain IP; %w", firstErr)
+	}
+
+	for _, uplink := range uplinks {
+		records := groups[uplink]
+		from := ""
+
+		if uplink != "" {
+			from = " from " + uplink
+		}
+
+		ips, err := detectPublicIPs(records, detection.forRecord(records[0]), config.Prefer)
+		if err != nil {
+			// The first error is returned, the others only logged.
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error getting public IP%s; %w", from, err)
+			} else {
+				writeErr(fmt.Sprintf("%s: error getting public IP%s; %s", Prog, from, err))
+			}
+
+			// Set members of the uplink have no address.
+			singles(records, PublicIPs{ErrIPv4: err, ErrIPv6: err})
+
+			ok = false
+
+			continue
+		}
+
+		records = singles(records, ips)
+
+		groupOK, ttl, err := setSubdomainRecords(providers, &records, ips, policy)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error setting subdomain IP; %w", err)
+		}
+
+		ok = ok && groupOK
+
+		if ttl > 0 && (minTTL == 0 || ttl < minTTL) {
+			minTTL = ttl
+		}
+	}
+
+	setsOK, ttl, err := setRoundRobin(providers, setKeys, members, policy)
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error setting subdomain IP; %w", err)
+	}
+
+	ok = ok && setsOK
+
+	if ttl > 0 && (minTTL == 0 || ttl < minTTL) {
+		minTTL = ttl
+	}
+
+	if err = policy.State.save(); err != nil {
+		writeErr(fmt.Sprintf("%s: error saving state; %s", Prog, err))
+	}
+
+	return ok, minTTL, firstErr
+}
+
+// runDaemon updates the records every interval, forever.
+// If clamp is true, the interval is raised to the smallest record TTL.
+func runDaemon(providers Providers, config *Config, detection Detection, policy Policy,
+	interval time.Duration, clamp bool, healthcheckURL string, reload func() (Config, error), changes <-chan struct{},
+) {
+	var advised bool
+
+	// SIGHUP reloads the config, once the current cycle is over.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	// The systemd watchdog is told that the daemon is alive between cycles,
+	// so that it restarts the daemon if a cycle hangs.
+	var watchdog <-chan time.Time
+
+	if every := watchdogInterval(); every > 0 {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		watchdog = ticker.C
+	}
+
+	notifySystemd("READY=1")
+
+	for cycle := 1; ; cycle++ {
+		writeOut(fmt.Sprintf("%s: update cycle %d", Prog, cycle))
+
+		// The Vault login expires, and the token kept in it may change.
+		if config.vault != nil {
+			providers = refreshToken(providers, config, policy.Timeout)
+		}
+
+		ok, ttl, err := update(providers, config, detection, policy)
+		if err != nil {
+			writeErr(fmt.Sprintf("%s: %s", Prog, err))
+		}
+
+		reportHealth(healthcheckURL, ok && err == nil)
+
+		minInterval := time.Duration(ttl) * time.Second
+		if interval < minInterval {
+			if clamp {
+				writeErr(fmt.Sprintf("%s: raising the interval from %s to the record TTL, %s", Prog, interval, minInterval))
+
+				interval = minInterval
+			} else if !advised {
+				writeOut(fmt.Sprintf("%s: running every %s, but the record TTL is %ds; "+
+					"changes can't propagate faster than the TTL", Prog, interval, ttl))
+
+				advised = true
+			}
+		}
+
+		status := "done"
+		if !ok || err != nil {
+			status = "failed"
+		}
+
+		notifySystemd(fmt.Sprintf("STATUS=cycle %d %s, next in %s\nWATCHDOG=1", cycle, status, interval))
+
+		wait := time.After(interval)
+
+		for waiting := true; waiting; {
+			select {
+			case <-wait:
+				waiting = false
+			case <-watchdog:
+				notifySystemd("WATCHDOG=1")
+			case <-hangup:
+				providers = reloadDaemon(providers, config, &detection, &policy, reload)
+				waiting = false
+			case <-changes:
+				writeOut(fmt.Sprintf("%s: the config file changed", Prog))
+
+				providers = reloadDaemon(providers, config, &detection, &policy, reload)
+				waiting = false
+			}
+		}
+	}
+}
+
+// reloadDaemon reads the config again with reload and, unless it is invalid,
+// uses it from then on, logging what changed, and returns the providers of
+// its records. The IP detection, but for the IP sources of the records, and
+// the timeouts are kept.
+func reloadDaemon(providers Providers, config *Config, detection *Detection, policy *Policy,
+	reload func() (Config, error),
+) Providers {
+	writeOut(fmt.Sprintf("%s: reloading the configuration", Prog))
+
+	updated, err := reload()
+	if err != nil {
+		writeErr(fmt.Sprintf("%s: error reloading configuration, %s; keeping the current one", Prog, err))
+
+		return providers
+	}
+
+	updatedProviders, err := newProviders(&updated)
+	if err != nil {
+		writeErr(fmt.Sprintf("%s: error reloading configuration, %s; keeping the current one", Prog, err))
+
+		return providers
+	}
+
+	sources, err := newRecordSources(&updated)
+	if err != nil {
+		writeErr(fmt.Sprintf("%s: error reloading configuration, %s; keeping the current one", Prog, err))
+
+		return providers
+	}
+
+	if logTarget == LogTargetFile && updated.Log != config.Log {
+		_ = mlog.Stop()
+
+		if err = initLogger(updated.Log); err != nil {
+			_ = initLogger(config.Log)
+
+			writeErr(fmt.Sprintf("%s: error writing to log file, %s; keeping the current configuration", Prog, err))
+
+			return providers
+		}
+	}
+
+	changes := configChanges(config, &updated)
+	if len(changes) == 0 {
+		changes = []string{"no changes"}
+	}
+
+	for _, change := range changes {
+		writeOut(fmt.Sprintf("%s: reloaded configuration: %s", Prog, change))
+	}
+
+	*config = updated
+	detection.Sources = sources
+	policy.Duplicates, policy.PruneOtherFamily = updated.Duplicates, updated.PruneOtherFamily
+
+	return updatedProviders
+}
+
+// configChanges describes what changed from the config old to updated: the
+// records added, removed or otherwise changed, and the other settings, by
+// name only, since they may be secrets.
+func configChanges(old, updated *Config) []string {
+	var changes []string
+
+	key := func(record Record) string {
+		return record.Type + " " + record.String()
+	}
+
+	oldRecords := map[string]Record{}
+	for _, record := range old.Records {
+		oldRecords[key(record)] = record
+	}
+
+	updatedRecords := map[string]bool{}
+
+	for _, record := range updated.Records {
+		updatedRecords[key(record)] = true
+
+		was, ok := oldRecords[key(record)]
+
+		switch {
+		case !ok:
+			changes = append(changes, "added record "+key(record))
+		case was.TTL != record.TTL:
+			changes = append(changes, fmt.Sprintf("changed the TTL of %s from %d to %d", key(record), was.TTL, record.TTL))
+		case !reflect.DeepEqual(was, record):
+			changes = append(changes, "changed record "+key(record))
+		}
+	}
+
+	for _, record := range old.Records {
+		if !updatedRecords[key(record)] {
+			changes = append(changes, "removed record "+key(record))
+		}
+	}
+
+	var before, after map[string]json.RawMessage
+
+	oldContent, _ := json.Marshal(old)
+	updatedContent, _ := json.Marshal(updated)
+
+	if json.Unmarshal(oldContent, &before) != nil || json.Unmarshal(updatedContent, &after) != nil {
+		return changes
+	}
+
+	names := make([]string, 0, len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name != "records" && !bytes.Equal(before[name], after[name]) {
+			changes = append(changes, "changed "+name)
+		}
+	}
+
+	return changes
+}
+
+// reloadConfig reads the config again for the daemon, as in main, with the
+// records and other settings given in the options.
+func reloadConfig(options Options) (Config, error) {
+	config, _, err := loadConfig(options)
 	if err != nil {
-		die("error reading configuration", err)
+		return config, err
+	}
+
+	if err = config.readToken(); err != nil {
+		return config, fmt.Errorf("error reading token; %w", err)
+	}
+
+	if err = config.selectRecords(options); err != nil {
+		return config, err
+	}
+
+	if _, _, _, problems := validateConfig(config); len(problems) > 0 {
+		return config, &ConfigError{Problems: problems}
+	}
+
+	if err = config.resolve(options); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// refreshToken reads the token of the config from Vault again, and returns
+// the providers with it if it changed, or else the same providers.
+func refreshToken(providers Providers, config *Config, timeout time.Duration) Providers {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	token, err := config.vault.secret(ctx)
+	if err != nil {
+		writeErr(fmt.Sprintf("%s: error reading token, %s; keeping the last one", Prog, err))
+
+		return providers
+	} else if token == config.Token {
+		return providers
+	}
+
+	withToken := *config
+	withToken.Token = token
+
+	updated, err := newProviders(&withToken)
+	if err != nil {
+		writeErr(fmt.Sprintf("%s: error using the new token, %s; keeping the last one", Prog, err))
+
+		return providers
+	}
+
+	writeOut(fmt.Sprintf("%s: using the new token from Vault", Prog))
+
+	config.Token = token
+
+	return updated
+}
+
+// adviseTTL writes a one-time notice when do-dyndns runs more often than the
+// given record TTL, since DNS resolvers won't see updates any faster anyway.
+// The interval between runs is the age of LastRunFile, which is touched on
+// every run and also remembers the TTL of the last notice.
+func adviseTTL(ttl int) {
+	if ttl <= 0 {
+		return
+	}
+
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+
+	lastRunFile := filepath.Join(userCacheDir, Prog, LastRunFile)
+	ttlText := strconv.Itoa(ttl)
+
+	// notified is the TTL of the last notice, if any.
+	var notified string
+
+	if info, err := os.Stat(lastRunFile); err == nil {
+		content, _ := os.ReadFile(lastRunFile)
+		notified = string(content)
+		interval := time.Since(info.ModTime())
+
+		if notified != ttlText && interval < time.Duration(ttl)*time.Second {
+			writeOut(fmt.Sprintf("%s: running every %s, but the record TTL is %ds; "+
+				"changes can't propagate faster than the TTL", Prog, interval.Round(time.Second), ttl))
+
+			notified = ttlText
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(lastRunFile), 0755); err != nil {
+		return
+	}
+
+	_ = os.WriteFile(lastRunFile, []byte(notified), 0644)
+}
+
+// listDomains prints the names of all the domains managed by the account,
+// waiting up to timeout for the provider.
+func listDomains(provider Provider, timeout time.Duration) error {
+	lister, ok := provider.(DomainLister)
+	if !ok {
+		return errors.New("the provider can't list domains")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	domains, err := lister.Domains(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range domains {
+		fmt.Println(domain)
+	}
+
+	return nil
+}
+
+// parseArguments parses the command line options.
+func parseArguments() (options Options) {
+	flag.BoolVar(&options.Help, "h", false, "")
+	flag.BoolVar(&options.Help, "help", false, "")
+	flag.BoolVar(&options.Version, "v", false, "")
+	flag.BoolVar(&options.Version, "version", false, "")
+	flag.BoolVar(&options.ListDomains, "list-domains", false, "")
+	flag.BoolVar(&options.Prepare, "prepare", false, "")
+	flag.BoolVar(&options.Dedupe, "dedupe", false, "")
+	flag.StringVar(&options.BindAddress, "bind-address", "", "")
+	flag.StringVar(&options.BindInterface, "bind-interface", "", "")
+	flag.StringVar(&options.Interface, "interface", "", "")
+	flag.Var(&options.IPs, "ip", "")
+	flag.StringVar(&options.IPFrom, "ip-from", "", "")
+	flag.StringVar(&options.HealthcheckURL, "healthcheck-url", "", "")
+	flag.BoolVar(&options.HealthcheckFail, "healthcheck-fail", false, "")
+	flag.StringVar(&options.LogTarget, "log-target", "", "")
+	flag.StringVar(&options.ConfigFile, "config", os.Getenv(ConfigFileEnv), "")
+	flag.StringVar(&options.IdentityFile, "identity", os.Getenv(IdentityFileEnv), "")
+	flag.BoolVar(&options.NoLegacyConfig, "no-legacy-config", false, "")
+	flag.BoolVar(&options.ReadOnly, "read-only", false, "")
+	flag.StringVar(&options.TokenFile, "token-file", "", "")
+	flag.StringVar(&options.Profile, "profile", "", "")
+	flag.BoolVar(&options.IPv4, "4", false, "")
+	flag.BoolVar(&options.IPv6, "6", false, "")
+	flag.BoolVar(&options.JSON, "json", false, "")
+	flag.BoolVar(&options.All, "all", false, "")
+	flag.BoolVar(&options.Online, "online", false, "")
+	flag.StringVar(&options.From, "from", "ddclient", "")
+	options.Type = "A"
+	flag.Var(typeFlag{fallback: &options.Type, subdomains: &options.Subdomains}, "type", "")
+	flag.Var(&options.Subdomains, "subdomain", "")
+	flag.StringVar(&options.RecordName, "record-name", "", "")
+	flag.StringVar(&options.Domain, "domain", "", "")
+	flag.BoolVar(&options.Verify, "verify", false, "")
+	flag.BoolVar(&options.Force, "force", false, "")
+	flag.BoolVar(&options.Daemon, "daemon", false, "")
+	flag.DurationVar(&options.Interval, "interval", 0, "")
+	flag.BoolVar(&options.ClampInterval, "clamp-interval", false, "")
+	flag.BoolVar(&options.WatchConfig, "watch-config", false, "")
+
+	// The command, if any, comes first.
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		options.Command, args = args[0], args[1:]
+	}
+
+	_ = flag.CommandLine.Parse(args)
+
+	return options
+}
+
+// setNetwork sets how provider API requests go out, as in config and the
+// command line options: their bind address or interface, proxy and retries.
+// It returns the bind address, if any, for detection too.
+func setNetwork(config *Config, options Options) (net.IP, error) {
+	var (
+		bindAddress net.IP
+		err         error
+	)
+
+	if options.BindAddress != "" {
+		bindAddress = net.ParseIP(options.BindAddress)
+		if bindAddress == nil {
+			return nil, fmt.Errorf("invalid bind address, %s", options.BindAddress)
+		}
+	}
+
+	if options.BindInterface != "" {
+		if _, err = net.InterfaceByName(options.BindInterface); err != nil {
+			return nil, fmt.Errorf("invalid bind interface, %s", options.BindInterface)
+		}
+	}
+
+	// Both detection and API traffic go out through the chosen uplink.
+	apiBindAddress, bindInterface = bindAddress, options.BindInterface
+
+	if config.Proxy != "" {
+		if proxyURL, err = parseProxy(config.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	if apiRetry, err = newRetry("api", config.APIRetry); err != nil {
+		return nil, err
+	}
+
+	return bindAddress, nil
+}
+
+// RUN.
+func main() {
+	options := parseArguments()
+	if options.Help {
+		_, err := fmt.Fprintf(os.Stderr, Usage, Prog, Prog, Prog, Prog)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	} else if options.Version {
+		_, err := fmt.Fprintf(os.Stderr, "%s %s\n", Prog, Version)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	switch options.LogTarget {
+	case "":
+	case LogTargetStdout, LogTargetFile, LogTargetSyslog:
+		logTarget = options.LogTarget
+	default:
+		logTarget = LogTargetStdout
+		die(fmt.Sprintf("invalid log target, %s", options.LogTarget), nil)
+	}
+
+	// The log file is the default target of cron jobs, but not an explicit
+	// one.
+	if options.ReadOnly && logTarget == LogTargetFile {
+		logTarget = LogTargetStdout
+
+		if options.LogTarget == LogTargetFile {
+			die("--read-only forbids --log-target file", nil)
+		}
+	}
+
+	// Prepared records are only restored from the saved state.
+	if options.ReadOnly && options.Prepare {
+		die("--read-only forbids --prepare", nil)
+	}
+
+	if logTarget == LogTargetSyslog {
+		if err := initSyslog(); err != nil {
+			logTarget = LogTargetStdout
+			die("error connecting to syslog", err)
+		}
+	}
+
+	if options.Command != "" && !Commands[options.Command] {
+		die(fmt.Sprintf("unknown command, %s", options.Command), nil)
+	}
+
+	if options.HealthcheckURL != "" && options.HealthcheckFail {
+		healthcheckFailURL = strings.TrimSuffix(options.HealthcheckURL, "/") + "/fail"
+	}
+
+	if options.Command == CommandInit {
+		configFile, err := runInit(os.Stdin, options.ConfigFile)
+		if err != nil {
+			die("error creating configuration", err)
+		}
+
+		writeOut(fmt.Sprintf("wrote %s", configFile))
+		os.Exit(0)
+	}
+
+	if options.Command == CommandToken {
+		if err := runToken(flag.Arg(0), os.Stdin); err != nil {
+			die("error accessing the keyring", err)
+		}
+
+		os.Exit(0)
+	}
+
+	if options.Command == CommandImport {
+		if err := runImport(options.From, flag.Arg(0)); err != nil {
+			die("error importing configuration", err)
+		}
+
+		os.Exit(0)
+	}
+
+	config, configFile, err := loadConfig(options)
+	if err != nil {
+		dieConfig(err)
+	}
+
+	if err = config.readToken(); err != nil {
+		die("error reading token", err)
 	}
 
-	if !tty && !systemd {
+	if logTarget == LogTargetFile {
 		err := initLogger(config.Log)
 		if err != nil {
 			die("error writing to log file", err)
 		}
 	}
 
-	if config.Token == "" {
-		die("missing token", nil)
+	warnLegacyConfig(options, configFile)
+
+	if options.Command == CommandValidate {
+		if !runValidate(config, configFile, options) {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if err = config.selectRecords(options); err != nil {
+		die(err.Error(), nil)
+	}
+
+	// Runs check the config as validate does, with their own records, and
+	// report all its problems before setting any record.
+	if _, _, _, problems := validateConfig(config); len(problems) > 0 {
+		dieConfig(&ConfigError{File: configFile, Problems: problems})
+	}
+
+	if err = config.resolve(options); err != nil {
+		die(err.Error(), nil)
+	}
+
+	bindAddress, err := setNetwork(&config, options)
+	if err != nil {
+		die(err.Error(), nil)
+	}
+
+	apiTimeout, err := parseTimeout("api", config.Timeouts.API, APITimeout)
+	if err != nil {
+		die(err.Error(), nil)
+	}
+
+	if healthcheckTimeout, err = parseTimeout("healthcheck", config.Timeouts.Healthcheck, HealthcheckTimeout); err != nil {
+		die(err.Error(), nil)
+	}
+
+	if options.ListDomains {
+		provider, err := newProvider(config.Provider, &config)
+		if err != nil {
+			die(err.Error(), nil)
+		}
+
+		if err = listDomains(provider, apiTimeout); err != nil {
+			die("error listing domains", err)
+		}
+
+		os.Exit(0)
+	}
+
+	if options.Command == CommandExport {
+		if options.Domain == "" {
+			die("missing domain to export", nil)
+		}
+
+		provider, err := newProvider(config.Provider, &config)
+		if err != nil {
+			die(err.Error(), nil)
+		}
+
+		if err = exportRecords(provider, options.Domain, flag.Args(), apiTimeout); err != nil {
+			die("error exporting records", err)
+		}
+
+		os.Exit(0)
+	}
+
+	detection, err := newDetection(&config, bindAddress)
+	if err != nil {
+		die(err.Error(), nil)
+	}
+
+	// Addresses given on the command line replace detection.
+	switch {
+	case len(options.IPs) > 0 && options.IPFrom != "":
+		die("--ip and --ip-from cannot be used together", nil)
+	case len(options.IPs) > 0:
+		static, err := newStaticDetector(strings.Join(options.IPs, " "))
+		if err != nil {
+			die(err.Error(), nil)
+		}
+
+		detection.Detectors, detection.Consensus, detection.Given = []Detector{static}, 0, true
+	case options.IPFrom == "-":
+		// Standard input can only be read once, even in daemon mode.
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			die("error reading standard input", err)
+		}
+
+		static, err := newStaticDetector(string(content))
+		if err != nil {
+			die(err.Error(), nil)
+		}
+
+		detection.Detectors, detection.Consensus, detection.Given = []Detector{static}, 0, true
+	case options.IPFrom != "":
+		detection.Detectors, detection.Consensus = []Detector{FileDetector{Path: options.IPFrom}}, 0
+		detection.Given = true
+	}
+
+	if options.Command == CommandIP {
+		ipv4, ipv6 := options.IPv4 || !options.IPv6, options.IPv6 || !options.IPv4
+
+		if err = printIP(detection, ipv4, ipv6, options.JSON); err != nil {
+			die("error getting public IP", err)
+		}
+
+		os.Exit(0)
+	}
+
+	// Providers are reused between cycles in daemon mode.
+	providers, err := newProviders(&config)
+	if err != nil {
+		die(err.Error(), nil)
+	}
+
+	if options.Command == CommandList {
+		if err = printRecords(providers, config.Records, apiTimeout); err != nil {
+			die("error listing records", err)
+		}
+
+		os.Exit(0)
+	}
+
+	if options.Command == CommandStatus {
+		var inSync bool
+
+		if inSync, err = printStatus(providers, &config, detection, apiTimeout); err != nil {
+			die("error getting status", err)
+		}
+
+		if !inSync {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	policy := Policy{
+		Duplicates: config.Duplicates,
+		Verify:     options.Verify,
+		Force:      options.Force,
+		Timeout:    apiTimeout,
+		Precheck:   config.DNSPrecheck,
+
+		PruneOtherFamily: config.PruneOtherFamily,
+	}
+
+	stateMaxAge, err := parseStateMaxAge(config.StateMaxAge)
+	if err != nil {
+		die(err.Error(), nil)
+	}
+
+	// Duplicates are only found by asking the providers.
+	if options.Dedupe {
+		stateMaxAge, policy.Precheck = 0, ""
+	}
+
+	policy.State = loadState(configFile, stateMaxAge)
+
+	// The state is read, but never written.
+	if options.ReadOnly {
+		policy.State.path = ""
+	}
+
+	if options.Command == CommandDelete {
+		if options.All == (len(options.Subdomains) > 0 || options.Domain != "") {
+			die("either --subdomain, --domain or --all is needed to delete records", nil)
+		}
+
+		policy.Zones = Zones{}
+
+		if err = deleteConfigured(providers, config.Records, policy); err != nil {
+			die("error deleting records", err)
+		}
+
+		os.Exit(0)
+	}
+
+	if options.Prepare {
+		policy.Zones = Zones{}
+
+		if err = prepareRecords(providers, config.Records, policy); err != nil {
+			die("error preparing records", err)
+		}
+
+		os.Exit(0)
+	}
+
+	if options.Daemon || options.Interval > 0 {
+		if options.Interval <= 0 {
+			options.Interval = DefaultInterval
+		}
+
+		// Without --watch-config, changes is nil, and never receives.
+		var changes <-chan struct{}
+
+		if options.WatchConfig {
+			if configFile == ConfigJSONEnv || configFile == RecordsEnv {
+				die("--watch-config needs a config file", nil)
+			}
+
+			if changes, err = watchFile(configFile); err != nil {
+				die("error watching the config file", err)
+			}
+		}
+
+		runDaemon(providers, &config, detection, policy, options.Interval, options.ClampInterval, options.HealthcheckURL,
+			func() (Config, error) {
+				return reloadConfig(options)
+			}, changes)
 	}
 
-	var ip net.IP
+	ok, ttl, err := update(providers, &config, detection, policy)
+
+	if !tty && !options.ReadOnly {
+		adviseTTL(ttl)
+	}
 
-	ip, err = myPublicIP()
 	if err != nil {
-		die("error getting public IP", err)
+		die(err.Error(), nil)
 	}
 
-	setSubdomainRecords(config.Token, &config.Records, ip)
+	reportHealth(options.HealthcheckURL, ok)
 }
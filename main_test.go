@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWarnLegacyConfig(t *testing.T) {
+	const content = `{"token": "x", "records": [{"type": "A", "subdomain": "home.example.com"}]}`
+
+	tests := []struct {
+		name    string
+		files   []string
+		option  string
+		warning bool
+	}{
+		{name: "legacy file", files: []string{DotConfigFile}, warning: true},
+		{name: "legacy file with --config", files: []string{DotConfigFile}, option: DotConfigFile},
+		{name: "user config", files: []string{"", DotConfigFile}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := t.TempDir()
+
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+			t.Setenv("XDG_CONFIG_DIRS", filepath.Join(home, "xdg"))
+
+			// An empty name is the config file in the user config directory.
+			for _, name := range test.files {
+				file := filepath.Join(home, name)
+
+				if name == "" {
+					configDir, err := os.UserConfigDir()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					file = filepath.Join(configDir, Prog, ConfigFiles[0])
+				}
+
+				if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var options Options
+			if test.option != "" {
+				options.ConfigFile = filepath.Join(home, test.option)
+			}
+
+			_, stderr := captureOutput(t, func() {
+				_, configFile, err := loadConfig(options)
+				if err != nil {
+					t.Error(err)
+
+					return
+				}
+
+				warnLegacyConfig(options, configFile)
+			})
+
+			want := ""
+			if test.warning {
+				want = "do-dyndns: using legacy config file " + filepath.Join(home, DotConfigFile) + "\n"
+			}
+
+			if stderr != want {
+				t.Errorf("got stderr %q, want %q", stderr, want)
+			}
+		})
+	}
+}
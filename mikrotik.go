@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MikroTikConfig is the "mikrotik" section of the config file.
+type MikroTikConfig struct {
+	// URL is the base URL of the router web service, e.g.
+	// "https://192.168.88.1".
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Interface is the WAN interface of the router, e.g. "ether1" or
+	// "pppoe-out1".
+	Interface string `json:"interface"`
+}
+
+// MikroTikDetector asks a MikroTik router, with the REST API of RouterOS 7,
+// for the address of its WAN interface.
+type MikroTikDetector struct {
+	config MikroTikConfig
+}
+
+// newMikroTikDetector returns a MikroTik detector.
+func newMikroTikDetector(config MikroTikConfig) (MikroTikDetector, error) {
+	if config.URL == "" || config.Username == "" || config.Interface == "" {
+		return MikroTikDetector{}, errors.New("missing MikroTik URL, username or interface")
+	}
+
+	config.URL = strings.TrimSuffix(config.URL, "/")
+
+	return MikroTikDetector{config: config}, nil
+}
+
+// Detect returns the first public address of the WAN interface.
+func (d MikroTikDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	path := "/rest/ip/address"
+	if ipv6 {
+		path = "/rest/ipv6/address"
+	}
+
+	query := url.Values{}
+	query.Set("interface", d.config.Interface)
+
+	target := d.config.URL + path + "?" + query.Encode()
+
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+
+		base64.StdEncoding.EncodeToString([]byte(d.config.Username+":"+d.config.Password)))
+
+	var addresses []struct {
+		Address  string `json:"address"`
+		Disabled string `json:"disabled"`
+		Invalid  string `json:"invalid"`
+	}
+
+	if err := deviceRequest(ctx, "MikroTik", target, header, bindAddress, &addresses); err != nil {
+		return nil, err
+	}
+
+	for _, address := range addresses {
+		if address.Disabled == "true" || address.Invalid == "true" {
+			continue
+		}
+
+		// Addresses come with their prefix length, e.g. "203.0.113.5/24".
+		ip, _, err := net.ParseCIDR(address.Address)
+		if err == nil && isPublic(ip) {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no public address on interface %s", d.config.Interface)
+}
+
+// String returns the router asked.
+func (d MikroTikDetector) String() string {
+	return "MikroTik at " + d.config.URL
+}
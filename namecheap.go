@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// NamecheapURL is the Namecheap dynamic DNS update URL.
+const NamecheapURL = "https://dynamicdns.park-your-domain.com/update"
+
+// NamecheapConfig is the "namecheap" section of the config file.
+type NamecheapConfig struct {
+	// Passwords maps domains to their Dynamic DNS password, from the
+	// Advanced DNS page of each domain.
+	Passwords map[string]string `json:"passwords"`
+}
+
+// Namecheap is the Namecheap dynamic DNS client, which can only set A records.
+type Namecheap struct {
+	client    *http.Client
+	passwords map[string]string
+}
+
+// newNamecheap returns a Namecheap dynamic DNS provider.
+func newNamecheap(config NamecheapConfig) (*UpdateOnly, error) {
+	if len(config.Passwords) == 0 {
+		return nil, errors.New("missing Namecheap Dynamic DNS passwords")
+	}
+
+	client := &Namecheap{client: newAPIClient(), passwords: config.Passwords}
+
+	return newUpdateOnly("Namecheap dynamic DNS", client.update), nil
+}
+
+// update sets the address of a record in domain.
+func (p *Namecheap) update(ctx context.Context, domain string, record DNSRecord) error {
+	if record.Type != "A" {
+		return fmt.Errorf("only A records can be set with Namecheap dynamic DNS, not %s", record.Type)
+	}
+
+	password, ok := p.passwords[domain]
+	if !ok {
+		return fmt.Errorf("%w in Namecheap passwords: %s", ErrDomainNotFound, domain)
+	}
+
+	query := url.Values{}
+	query.Set("host", record.Name)
+	query.Set("domain", domain)
+	query.Set("password", password)
+	query.Set("ip", record.Data)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, NamecheapURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var result struct {
+		ErrCount int    `xml:"ErrCount"`
+		Err      string `xml:"errors>Err1"`
+	}
+
+	if err = xml.Unmarshal(content, &result); err != nil {
+		return err
+	}
+
+	if result.ErrCount > 0 {
+		return fmt.Errorf("update rejected by Namecheap, %s", result.Err)
+	}
+
+	return nil
+}
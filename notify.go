@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// notifySocket is the socket that systemd listens on for the state of a
+// Type=notify service, if started as one.
+var notifySocket = os.Getenv("NOTIFY_SOCKET")
+
+// notifyFailed is whether notifying systemd has failed before.
+var notifyFailed bool
+
+// sdNotify sends state to systemd, as with sd_notify(3), e.g. "READY=1".
+// It does nothing unless systemd started do-dyndns as a Type=notify service.
+func sdNotify(state string) error {
+	if notifySocket == "" {
+		return nil
+	}
+
+	addr := &net.UnixAddr{Name: notifySocket, Net: "unixgram"}
+
+	// Names starting with @ are in the abstract namespace.
+	if notifySocket[0] == '@' {
+		addr.Name = "\x00" + notifySocket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+
+	defer func(conn *net.UnixConn) {
+		_ = conn.Close()
+	}(conn)
+
+	_, err = conn.Write([]byte(state))
+
+	return err
+}
+
+// notifySystemd is like sdNotify, but logs the error, once, instead.
+func notifySystemd(state string) {
+	if err := sdNotify(state); err != nil && !notifyFailed {
+		writeErr(Prog + ": error notifying systemd, " + err.Error())
+
+		notifyFailed = true
+	}
+}
+
+// watchdogInterval returns how often to tell the systemd watchdog that the
+// daemon is alive, half its WatchdogSec, or 0 if it is not enabled for
+// do-dyndns.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
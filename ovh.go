@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // OVH signs requests with SHA-1.
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OVHEndpoints are the base URLs of the OVH APIs, by endpoint name.
+var OVHEndpoints = map[string]string{
+	"ovh-eu":        "https://eu.api.ovh.com/1.0",
+	"ovh-ca":        "https://ca.api.ovh.com/1.0",
+	"ovh-us":        "https://api.us.ovhcloud.com/1.0",
+	"kimsufi-eu":    "https://eu.api.kimsufi.com/1.0",
+	"soyoustart-eu": "https://eu.api.soyoustart.com/1.0",
+}
+
+// OVHConfig is the "ovh" section of the config file.
+type OVHConfig struct {
+	// Endpoint is one of OVHEndpoints, "ovh-eu" by default.
+	Endpoint          string `json:"endpoint"`
+	ApplicationKey    string `json:"application_key"`
+	ApplicationSecret string `json:"application_secret"`
+	ConsumerKey       string `json:"consumer_key"`
+}
+
+// OVH is the OVH DNS provider.
+type OVH struct {
+	client *http.Client
+	api    string
+	keys   OVHConfig
+	// delta is the difference between the OVH clock and ours, in seconds,
+	// or nil until known.
+	delta *int64
+}
+
+// ovhRecord is a DNS record in the OVH API.
+type ovhRecord struct {
+	ID        int    `json:"id,omitempty"`
+	FieldType string `json:"fieldType,omitempty"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int    `json:"ttl,omitempty"`
+}
+
+// newOVH returns an OVH DNS provider.
+func newOVH(config OVHConfig) (*OVH, error) {
+	if config.ApplicationKey == "" || config.ApplicationSecret == "" || config.ConsumerKey == "" {
+		return nil, errors.New("missing OVH application key, application secret or consumer key")
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "ovh-eu"
+	}
+
+	api, ok := OVHEndpoints[config.Endpoint]
+	if !ok {
+		return nil, fmt.Errorf("unknown OVH endpoint, %s", config.Endpoint)
+	}
+
+	return &OVH{client: newAPIClient(), api: api, keys: config}, nil
+}
+
+// timestamp returns the current time of the OVH API, which requests must
+// be signed with.
+func (p *OVH) timestamp(ctx context.Context) (string, error) {
+	if p.delta == nil {
+		var now int64
+
+		if err := requestJSON(ctx, p.client, http.MethodGet, p.api+"/auth/time", nil, nil, &now); err != nil {
+			return "", err
+		}
+
+		delta := now - time.Now().Unix()
+		p.delta = &delta
+	}
+
+	return strconv.FormatInt(time.Now().Unix()+*p.delta, 10), nil
+}
+
+// request sends a signed request to the OVH API and decodes the response.
+func (p *OVH) request(ctx context.Context, method, path string, body, out interface{}) error {
+	var content []byte
+
+	if body != nil {
+		var err error
+
+		if content, err = json.Marshal(body); err != nil {
+			return err
+		}
+
+		body = json.RawMessage(content)
+	}
+
+	timestamp, err := p.timestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := p.api + path
+	sum := sha1.Sum([]byte(strings.Join([]string{ //nolint:gosec // OVH signs requests with SHA-1.
+		p.keys.ApplicationSecret, p.keys.ConsumerKey, method, target, string(content), timestamp,
+	}, "+")))
+
+	header := http.Header{}
+	header.Set("X-Ovh-Application", p.keys.ApplicationKey)
+	header.Set("X-Ovh-Consumer", p.keys.ConsumerKey)
+	header.Set("X-Ovh-Timestamp", timestamp)
+	header.Set("X-Ovh-Signature", "$1$"+hex.EncodeToString(sum[:]))
+
+	err = requestJSON(ctx, p.client, method, target, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check the OVH keys and that the consumer key can access /domain/zone", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// ovhZonePath returns the API path of the zone for domain.
+func ovhZonePath(domain string) string {
+	return "/domain/zone/" + url.PathEscape(domain)
+}
+
+// refresh applies the changes made to the zone for domain.
+func (p *OVH) refresh(ctx context.Context, domain string) error {
+	return p.request(ctx, http.MethodPost, ovhZonePath(domain)+"/refresh", nil, nil)
+}
+
+// Records returns the records in domain with the given type and name.
+func (p *OVH) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	query := url.Values{}
+	query.Set("fieldType", recordType)
+	query.Set("subDomain", blankApex(name))
+
+	var ids []int
+
+	err := p.request(ctx, http.MethodGet, ovhZonePath(domain)+"/record?"+query.Encode(), nil, &ids)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("%w in OVH account: %s", ErrDomainNotFound, domain)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(ids))
+
+	for _, id := range ids {
+		var record ovhRecord
+
+		if err = p.request(ctx, http.MethodGet, ovhZonePath(domain)+"/record/"+strconv.Itoa(id), nil, &record); err != nil {
+			return nil, err
+		}
+
+		records = append(records, DNSRecord{
+			ID:   strconv.Itoa(record.ID),
+			Type: record.FieldType,
+			Name: name,
+			Data: record.Target,
+			TTL:  record.TTL,
+		})
+	}
+
+	return records, nil
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *OVH) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	var created ovhRecord
+
+	body := ovhRecord{
+		FieldType: record.Type, SubDomain: blankApex(record.Name), Target: absoluteData(record.Type, record.Data),
+		TTL: record.TTL,
+	}
+
+	if err := p.request(ctx, http.MethodPost, ovhZonePath(domain)+"/record", body, &created); err != nil {
+		return record, err
+	}
+
+	record.ID = strconv.Itoa(created.ID)
+	record.TTL = created.TTL
+
+	return record, p.refresh(ctx, domain)
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *OVH) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	body := ovhRecord{SubDomain: blankApex(record.Name), Target: absoluteData(record.Type, record.Data), TTL: record.TTL}
+
+	if err := p.request(ctx, http.MethodPut, ovhZonePath(domain)+"/record/"+record.ID, body, nil); err != nil {
+		return err
+	}
+
+	return p.refresh(ctx, domain)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *OVH) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	if err := p.request(ctx, http.MethodDelete, ovhZonePath(domain)+"/record/"+record.ID, nil, nil); err != nil {
+		return err
+	}
+
+	return p.refresh(ctx, domain)
+}
+
+// Domains returns the names of all the zones in the account.
+func (p *OVH) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	if err := p.request(ctx, http.MethodGet, "/domain/zone", nil, &names); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PorkbunAPI is the base URL of the Porkbun API.
+const PorkbunAPI = "https://api.porkbun.com/api/json/v3"
+
+// PorkbunConfig is the "porkbun" section of the config file.
+type PorkbunConfig struct {
+	APIKey       string `json:"apikey"`
+	SecretAPIKey string `json:"secretapikey"`
+}
+
+// Porkbun is the Porkbun DNS provider.
+type Porkbun struct {
+	client *http.Client
+	keys   PorkbunConfig
+}
+
+// porkbunRecord is a DNS record in the Porkbun API.
+type porkbunRecord struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     string `json:"ttl"`
+	Prio    string `json:"prio"`
+}
+
+// porkbunRequest is the body of Porkbun API requests, which all carry the
+// API keys.
+type porkbunRequest struct {
+	PorkbunConfig
+	Name    string `json:"name,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Content string `json:"content,omitempty"`
+	TTL     string `json:"ttl,omitempty"`
+	Prio    string `json:"prio,omitempty"`
+	Start   int    `json:"start,omitempty"`
+}
+
+// newPorkbun returns a Porkbun DNS provider.
+func newPorkbun(config PorkbunConfig) (*Porkbun, error) {
+	if config.APIKey == "" || config.SecretAPIKey == "" {
+		return nil, errors.New("missing Porkbun API keys")
+	}
+
+	return &Porkbun{client: newAPIClient(), keys: config}, nil
+}
+
+// request sends a request to the Porkbun API and decodes the response.
+// Every Porkbun API call is a POST.
+func (p *Porkbun) request(ctx context.Context, path string, body porkbunRequest, out interface{}) error {
+	body.PorkbunConfig = p.keys
+
+	err := requestJSON(ctx, p.client, http.MethodPost, PorkbunAPI+path, nil, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check the Porkbun API keys and that API access is on for the domain", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// toPorkbun converts a DNSRecord to a Porkbun request.
+func toPorkbun(record DNSRecord) porkbunRequest {
+	body := porkbunRequest{Name: blankApex(record.Name), Type: record.Type, Content: record.Data}
+
+	if record.TTL > 0 {
+		body.TTL = strconv.Itoa(record.TTL)
+	}
+
+	// The priority of SRV and MX records is not in the content.
+	if priority, rest, ok := splitPriority(record.Type, record.Data); ok {
+		body.Content, body.Prio = rest, strconv.Itoa(priority)
+	}
+
+	return body
+}
+
+// Records returns the records in domain with the given type and name.
+func (p *Porkbun) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	path := "/dns/retrieveByNameType/" + url.PathEscape(domain) + "/" + recordType
+
+	if name != "@" {
+		path += "/" + url.PathEscape(name)
+	}
+
+	var resp struct {
+		Records []porkbunRecord `json:"records"`
+	}
+
+	err := p.request(ctx, path, porkbunRequest{}, &resp)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && strings.Contains(httpErr.Body, "Invalid domain") {
+		return nil, fmt.Errorf("%w in Porkbun account: %s", ErrDomainNotFound, domain)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(resp.Records))
+
+	for _, record := range resp.Records {
+		ttl, _ := strconv.Atoi(record.TTL)
+
+		data := record.Content
+		if NumericFields[record.Type] > 0 {
+			priority, _ := strconv.Atoi(record.Prio)
+			data = joinData([]int{priority}, data)
+		}
+
+		records = append(records, DNSRecord{
+			ID:   record.ID,
+			Type: record.Type,
+			Name: relativeName(record.Name, domain),
+			Data: data,
+			TTL:  ttl,
+		})
+	}
+
+	return records, nil
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *Porkbun) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	var resp struct {
+		ID json.Number `json:"id"`
+	}
+
+	if err := p.request(ctx, "/dns/create/"+url.PathEscape(domain), toPorkbun(record), &resp); err != nil {
+		return record, err
+	}
+
+	record.ID = resp.ID.String()
+
+	return record, nil
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *Porkbun) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	return p.request(ctx, "/dns/edit/"+url.PathEscape(domain)+"/"+record.ID, toPorkbun(record), nil)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *Porkbun) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	return p.request(ctx, "/dns/delete/"+url.PathEscape(domain)+"/"+record.ID, porkbunRequest{}, nil)
+}
+
+// Domains returns the names of all the domains in the account.
+func (p *Porkbun) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for {
+		var resp struct {
+			Domains []struct {
+				Domain string `json:"domain"`
+			} `json:"domains"`
+		}
+
+		if err := p.request(ctx, "/domain/listAll", porkbunRequest{Start: len(names)}, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, domain := range resp.Domains {
+			names = append(names, domain.Domain)
+		}
+
+		// Domains are listed 1000 at a time.
+		if len(resp.Domains) < 1000 {
+			return names, nil
+		}
+	}
+}
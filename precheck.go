@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// PrecheckAuthoritative is the "dns_precheck" that asks the authoritative
+// name servers of each domain.
+const PrecheckAuthoritative = "authoritative"
+
+// precheck reports whether fqdn already resolves to the data of want, and
+// only to it, so that the provider API need not be called. It asks server,
+// or the first authoritative name server of the zone of fqdn if server is
+// PrecheckAuthoritative. Any failure reports false.
+func precheck(ctx context.Context, server, fqdn string, want DNSRecord) bool {
+	network := "ip4"
+
+	switch want.Type {
+	case "A":
+	case "AAAA":
+		network = "ip6"
+	default:
+		return false
+	}
+
+	if server == PrecheckAuthoritative {
+		if server = nameServer(ctx, fqdn); server == "" {
+			return false
+		}
+	}
+
+	// Queries go out like API calls, over the family of their bind address.
+	ipv6 := apiBindAddress != nil && apiBindAddress.To4() == nil
+
+	// Wildcard records answer for any name they cover, but "*" is not a
+	// valid name to look up.
+	if strings.HasPrefix(fqdn, "*.") {
+		fqdn = "_" + Prog + fqdn[1:]
+	}
+
+	ips, err := newResolver(server, ipv6, apiBindAddress).LookupIP(ctx, network, fqdn)
+	if err != nil || len(ips) != 1 {
+		return false
+	}
+
+	return ips[0].String() == want.Data
+}
+
+// nameServer returns the first name server of the zone of fqdn, the closest
+// enclosing name with NS records, or an empty string if none is found.
+func nameServer(ctx context.Context, fqdn string) string {
+	for name := fqdn; strings.Contains(name, "."); name = name[strings.Index(name, ".")+1:] {
+		if servers, err := net.DefaultResolver.LookupNS(ctx, name); err == nil && len(servers) > 0 {
+			return strings.TrimSuffix(servers[0].Host, ".")
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PrepareTTL is the TTL, in seconds, that --prepare sets the records to
+// ahead of an address change, so that resolvers pick up the new address
+// within a minute.
+const PrepareTTL = 60
+
+// PrepareHold is how long the address of a prepared record must stay the
+// same before its normal TTL is restored.
+const PrepareHold = time.Hour
+
+// PreparedRecord is the state of a record whose TTL was lowered with
+// --prepare: its normal TTL, and its address since when.
+type PreparedRecord struct {
+	TTL   int       `json:"ttl"`
+	Data  string    `json:"data"`
+	Since time.Time `json:"since"`
+}
+
+// prepare remembers that the record with key, whose address is data, was
+// lowered from its normal TTL.
+func (s *State) prepare(key string, ttl int, data string) {
+	// Preparing again keeps the normal TTL of the first time.
+	if prepared, ok := s.Prepared[key]; ok {
+		ttl = prepared.TTL
+	}
+
+	s.Prepared[key] = PreparedRecord{TTL: ttl, Data: data, Since: time.Now()}
+	delete(s.Records, key)
+
+	s.changed = true
+}
+
+// preparedTTL returns the TTL that the record with key, set to data, should
+// have if it was prepared: PrepareTTL until its address has not changed for
+// PrepareHold, and its normal TTL afterwards, when restore is true.
+func (s *State) preparedTTL(key, data string) (ttl int, prepared, restore bool) {
+	if s == nil {
+		return 0, false, false
+	}
+
+	record, ok := s.Prepared[key]
+	if !ok {
+		return 0, false, false
+	}
+
+	if record.Data != data {
+		record.Data, record.Since = data, time.Now()
+		s.Prepared[key] = record
+		s.changed = true
+	}
+
+	if time.Since(record.Since) < PrepareHold {
+		return PrepareTTL, true, false
+	}
+
+	return record.TTL, true, true
+}
+
+// restored forgets that the record with key was prepared, once its normal
+// TTL is set again.
+func (s *State) restored(key string) {
+	if s == nil {
+		return
+	}
+
+	delete(s.Prepared, key)
+
+	s.changed = true
+}
+
+// prepareRecords lowers the TTL of the records to PrepareTTL, keeping their
+// addresses, and remembers their normal TTL in policy.State so that later
+// runs restore it. It returns the first error found; records after an error
+// are still prepared.
+func prepareRecords(providers Providers, records []Record, policy Policy) error {
+	var firstErr error
+
+	for _, record := range records {
+		if _, _, err := record.split(); err != nil {
+			die(err.Error(), nil)
+		}
+
+		provider := providers[record.account()]
+		name, domain := policy.Zones.split(provider, record, policy.Timeout)
+
+		// AUTO records may be of either type.
+		for _, recordType := range configuredTypes(record) {
+			err := prepareRecord(provider, domain, DNSRecord{Type: recordType, Name: name}, record, policy)
+			if err != nil {
+				writeErr(fmt.Sprintf("%s: error preparing %s record for %s; %s", Prog, recordType, record, err))
+
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+
+	if err := policy.State.save(); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error saving state; %w", err)
+	}
+
+	return firstErr
+}
+
+// prepareRecord lowers the TTL of the records of provider in domain with
+// the type and name of want, set for record.
+func prepareRecord(provider Provider, domain string, want DNSRecord, record Record, policy Policy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	matches, err := provider.Records(ctx, domain, want.Type, want.Name)
+	if errors.Is(err, ErrDomainNotFound) || (err == nil && len(matches) == 0) {
+		// Only records already set can be prepared.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ttl := record.TTL
+	if ttl == 0 {
+		ttl = matches[0].TTL
+	}
+
+	// Without the normal TTL, it could not be restored later.
+	if ttl == 0 {
+		return errors.New("unknown TTL, set it in the config file")
+	}
+
+	for _, match := range matches {
+		if match.TTL == PrepareTTL {
+			continue
+		}
+
+		match.TTL = PrepareTTL
+
+		if err = provider.UpdateRecord(ctx, domain, match); err != nil {
+			return err
+		}
+	}
+
+	policy.State.prepare(stateKey(record.Provider, record, want), ttl, matches[0].Data)
+	writeOut(fmt.Sprintf("lowered TTL of %s %s to %d", want.Type, record, PrepareTTL))
+
+	return nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Provider is a DNS hosting service whose records do-dyndns can set.
+// Domains are given as managed by the provider, e.g. "example.com", and
+// record names relative to them, with "@" for the domain itself.
+type Provider interface {
+	// Records returns the records in domain with the given type and name.
+	Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error)
+	// CreateRecord creates a record in domain and returns it as created.
+	CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error)
+	// UpdateRecord updates an existing record in domain, identified by its ID.
+	UpdateRecord(ctx context.Context, domain string, record DNSRecord) error
+	// DeleteRecord deletes an existing record in domain, identified by its ID.
+	DeleteRecord(ctx context.Context, domain string, record DNSRecord) error
+}
+
+// DomainLister is implemented by providers that can list their domains.
+type DomainLister interface {
+	// Domains returns the names of all the domains managed by the account.
+	Domains(ctx context.Context) ([]string, error)
+}
+
+// ZoneLister is implemented by providers that can list all the records of
+// a domain.
+type ZoneLister interface {
+	// ZoneRecords returns all the records in domain, of any type and name.
+	ZoneRecords(ctx context.Context, domain string) ([]DNSRecord, error)
+}
+
+// DNSRecord is a DNS record as stored by a provider.
+type DNSRecord struct {
+	ID   string
+	Type string
+	Name string
+	Data string
+	TTL  int
+	// Proxied is for Cloudflare, where traffic can be proxied through it.
+	Proxied bool
+}
+
+// hasTTL returns whether a record with ttl has the TTL of want: any TTL if
+// want has none, or if it is proxied, which Cloudflare reports with TTL 1,
+// automatic.
+func (want DNSRecord) hasTTL(ttl int) bool {
+	return want.TTL == 0 || want.Proxied || ttl == want.TTL
+}
+
+// Provider names, for the "provider" config fields.
+const (
+	ProviderDigitalOcean = "digitalocean"
+	ProviderCloudflare   = "cloudflare"
+	ProviderRoute53      = "route53"
+	ProviderHetzner      = "hetzner"
+	ProviderGandi        = "gandi"
+	ProviderLinode       = "linode"
+	ProviderVultr        = "vultr"
+	ProviderNamecheap    = "namecheap"
+	ProviderPorkbun      = "porkbun"
+	ProviderDeSEC        = "desec"
+	ProviderOVH          = "ovh"
+	ProviderGoogle       = "google"
+	ProviderRFC2136      = "rfc2136"
+	ProviderDynDNS2      = "dyndns2"
+	ProviderDuckDNS      = "duckdns"
+)
+
+// ErrDomainNotFound is returned when a record's domain is not managed by the
+// provider account.
+var ErrDomainNotFound = errors.New("domain not found")
+
+// ErrUnauthorized is returned when a provider rejects the credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Providers are the providers used by the configured records, by name.
+type Providers map[string]Provider
+
+// newProvider returns the provider called name, set up from config.
+func newProvider(name string, config *Config) (Provider, error) {
+	switch name {
+	case ProviderDigitalOcean:
+		return newDigitalOcean(config.Token)
+	case ProviderCloudflare:
+		return newCloudflare(config.Cloudflare)
+	case ProviderRoute53:
+		return newRoute53(config.Route53)
+	case ProviderHetzner:
+		return newHetzner(config.Hetzner)
+	case ProviderGandi:
+		return newGandi(config.Gandi)
+	case ProviderLinode:
+		return newLinode(config.Linode)
+	case ProviderVultr:
+		return newVultr(config.Vultr)
+	case ProviderNamecheap:
+		return newNamecheap(config.Namecheap)
+	case ProviderPorkbun:
+		return newPorkbun(config.Porkbun)
+	case ProviderDeSEC:
+		return newDeSEC(config.DeSEC)
+	case ProviderOVH:
+		return newOVH(config.OVH)
+	case ProviderGoogle:
+		return newGoogleDNS(config.Google)
+	case ProviderRFC2136:
+		return newRFC2136(config.RFC2136)
+	case ProviderDynDNS2:
+		return newDynDNS2(config.DynDNS2)
+	case ProviderDuckDNS:
+		return newDuckDNS(config.DuckDNS)
+	}
+
+	return nil, fmt.Errorf("unknown provider, %s", name)
+}
+
+// withToken returns a copy of config with token as that of provider, for
+// records of another account, or false if provider has more than a token.
+func (c *Config) withToken(provider, token string) (*Config, bool) {
+	account := *c
+
+	switch provider {
+	case ProviderDigitalOcean:
+		account.Token = token
+	case ProviderCloudflare:
+		account.Cloudflare.Token = token
+	case ProviderGandi:
+		account.Gandi.Token = token
+	case ProviderDuckDNS:
+		account.DuckDNS.Token = token
+	default:
+		return nil, false
+	}
+
+	return &account, true
+}
+
+// newProviders returns all the providers used by the config records, one
+// for each account.
+func newProviders(config *Config) (Providers, error) {
+	providers := Providers{}
+
+	for _, record := range config.Records {
+		if _, ok := providers[record.account()]; ok {
+			continue
+		}
+
+		accountConfig := config
+
+		if record.Token != "" {
+			var ok bool
+
+			if accountConfig, ok = config.withToken(record.Provider, record.Token); !ok {
+				return nil, fmt.Errorf("token of %s only supported with %s, %s, %s and %s", record,
+					ProviderDigitalOcean, ProviderCloudflare, ProviderGandi, ProviderDuckDNS)
+			}
+		}
+
+		provider, err := newProvider(record.Provider, accountConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[record.account()] = provider
+	}
+
+	return providers, nil
+}
+
+// UpdateOnly is a Provider for dynamic DNS protocols that can set records
+// but not read them back. Records are assumed unknown until set by this
+// process, which then remembers their data to avoid needless updates in
+// daemon mode.
+type UpdateOnly struct {
+	name string
+	set  func(ctx context.Context, domain string, record DNSRecord) error
+	// last holds the last data set for each record, by type and FQDN.
+	last map[string]string
+}
+
+// newUpdateOnly returns an UpdateOnly provider that sets records with set.
+func newUpdateOnly(name string, set func(ctx context.Context, domain string, record DNSRecord) error) *UpdateOnly {
+	return &UpdateOnly{name: name, set: set, last: map[string]string{}}
+}
+
+// Records returns the record of name in domain with the data last set by
+// this process, if any.
+func (p *UpdateOnly) Records(_ context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	data, ok := p.last[recordType+" "+absoluteName(name, domain)]
+	if !ok {
+		return nil, nil
+	}
+
+	return []DNSRecord{{ID: name, Type: recordType, Name: name, Data: data}}, nil
+}
+
+// CreateRecord sets a record in domain; the service creates it if needed.
+func (p *UpdateOnly) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	record.ID = record.Name
+
+	return record, p.UpdateRecord(ctx, domain, record)
+}
+
+// UpdateRecord sets a record in domain.
+func (p *UpdateOnly) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	if err := p.set(ctx, domain, record); err != nil {
+		return err
+	}
+
+	p.last[record.Type+" "+absoluteName(record.Name, domain)] = record.Data
+
+	return nil
+}
+
+// DeleteRecord is not supported by update-only protocols.
+func (p *UpdateOnly) DeleteRecord(context.Context, string, DNSRecord) error {
+	return fmt.Errorf("records cannot be deleted with %s", p.name)
+}
+
+// blankApex returns the name of a record for providers that use an empty
+// name, instead of "@", for the domain itself.
+func blankApex(name string) string {
+	if name == "@" {
+		return ""
+	}
+
+	return name
+}
+
+// MaxTXTString is the maximum length of each string of a TXT record.
+const MaxTXTString = 255
+
+// HostTypes are the record types whose data ends with a host name.
+var HostTypes = map[string]bool{"CNAME": true, "SRV": true, "MX": true}
+
+// NumericFields are the number of fields before the host name in the data
+// of the record types that have them: the priority, weight and port of SRV
+// records, and the priority of MX records.
+var NumericFields = map[string]int{"SRV": 3, "MX": 1}
+
+// absoluteData returns the data of a record with the target host name, if
+// it has one, made absolute with a trailing dot, for providers that would
+// take it as relative to the domain otherwise.
+func absoluteData(recordType, data string) string {
+	if !HostTypes[recordType] || strings.HasSuffix(data, ".") {
+		return data
+	}
+
+	return data + "."
+}
+
+// sameData reports whether two data of records of recordType are the same;
+// host names are compared regardless of case and of a trailing dot.
+func sameData(recordType, data, other string) bool {
+	if !HostTypes[recordType] {
+		return data == other
+	}
+
+	return strings.EqualFold(strings.TrimSuffix(data, "."), strings.TrimSuffix(other, "."))
+}
+
+// dataFields splits the data of a record of NumericFields into its numbers
+// and its host name, for providers that take them separately. Numbers that
+// are missing or invalid are 0.
+func dataFields(recordType, data string) ([]int, string) {
+	fields := strings.Fields(data)
+	numbers := make([]int, NumericFields[recordType])
+
+	for i := range numbers {
+		if len(fields) > 0 {
+			numbers[i], _ = strconv.Atoi(fields[0])
+			fields = fields[1:]
+		}
+	}
+
+	return numbers, strings.Join(fields, " ")
+}
+
+// joinData returns the data of a record from its numbers and host name, the
+// reverse of dataFields.
+func joinData(numbers []int, host string) string {
+	fields := make([]string, 0, len(numbers)+1)
+
+	for _, number := range numbers {
+		fields = append(fields, strconv.Itoa(number))
+	}
+
+	return strings.Join(append(fields, host), " ")
+}
+
+// splitPriority splits the data of a record of NumericFields into its
+// priority and the rest, for providers with a priority field of their own;
+// ok is false for other record types.
+func splitPriority(recordType, data string) (priority int, rest string, ok bool) {
+	if NumericFields[recordType] == 0 {
+		return 0, data, false
+	}
+
+	numbers, host := dataFields(recordType, data)
+
+	return numbers[0], joinData(numbers[1:], host), true
+}
+
+// zoneData returns the data of a record in zone file format, as used by the
+// providers that set whole record sets: host names are absolute, and TXT
+// data is split into quoted strings of up to MaxTXTString bytes.
+func zoneData(recordType, data string) string {
+	if recordType != "TXT" {
+		return absoluteData(recordType, data)
+	}
+
+	var quoted []string
+
+	for {
+		chunk := data
+		if len(chunk) > MaxTXTString {
+			chunk = chunk[:MaxTXTString]
+		}
+
+		chunk = strings.ReplaceAll(chunk, `\`, `\\`)
+		quoted = append(quoted, `"`+strings.ReplaceAll(chunk, `"`, `\"`)+`"`)
+
+		if len(data) <= MaxTXTString {
+			return strings.Join(quoted, " ")
+		}
+
+		data = data[MaxTXTString:]
+	}
+}
+
+// parseZoneData returns the data of a record from zone file format, the
+// reverse of zoneData: the quoted strings of TXT data are joined, with
+// escaped characters, including \DDD decimal ones, replaced.
+func parseZoneData(recordType, value string) string {
+	if recordType != "TXT" || !strings.HasPrefix(value, `"`) {
+		return value
+	}
+
+	var data []byte
+
+	quoted := false
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case !quoted:
+			// Blanks between strings.
+		case c == '\\' && i+3 < len(value) && isDigits(value[i+1:i+4]):
+			n, _ := strconv.Atoi(value[i+1 : i+4])
+			data = append(data, byte(n))
+			i += 3
+		case c == '\\' && i+1 < len(value):
+			i++
+			data = append(data, value[i])
+		default:
+			data = append(data, c)
+		}
+	}
+
+	return string(data)
+}
+
+// isDigits reports whether text is made only of decimal digits.
+func isDigits(text string) bool {
+	for _, c := range text {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HTTPError is returned by requestJSON for unsuccessful HTTP responses.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return e.Status
+	}
+
+	return e.Status + ": " + e.Body
+}
+
+// isNotFound reports whether err is an HTTP 404 response.
+func isNotFound(err error) bool {
+	var httpErr *HTTPError
+
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
+// newAPIClient returns the HTTP client used by providers to call their APIs,
+// with connections from apiBindAddress and bindInterface, if set, and
+// failed requests retried as set by apiRetry.
+func newAPIClient() *http.Client {
+	transport := &http.Transport{
+		Proxy:             proxy,
+		DialContext:       newDialer("tcp", apiBindAddress).DialContext,
+		ForceAttemptHTTP2: true,
+	}
+
+	return &http.Client{Transport: retryTransport{base: transport, retry: apiRetry}}
+}
+
+// requestJSON sends an HTTP request to a provider API, with header and,
+// unless it is nil, body encoded as JSON. If out is not nil, the JSON
+// response is decoded into it. Unsuccessful responses return an HTTPError.
+func requestJSON(
+	ctx context.Context, client *http.Client, method, url string, header http.Header, body, out interface{},
+) error {
+	var reader io.Reader
+
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(content))}
+	}
+
+	if out == nil || len(content) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(content, out)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetries and DefaultBackoff are how many times to try again after a
+// failure, and how long to wait before the first retry, unless set otherwise
+// in the config file.
+const DefaultRetries = 2
+const DefaultBackoff = time.Second
+
+// MaxBackoff is the longest wait between retries.
+const MaxBackoff = time.Minute
+
+// RetryConfig is a retry section of the config file.
+type RetryConfig struct {
+	// Retries is how many times to try again after a failure, 0 for none.
+	Retries *int `json:"retries"`
+	// Backoff is how long to wait before the first retry, doubled before
+	// each of the next ones, as a duration like "1s".
+	Backoff string `json:"backoff"`
+}
+
+// Retry is how to retry a failing operation.
+type Retry struct {
+	Retries int
+	Backoff time.Duration
+}
+
+// newRetry returns the retry of a phase, from its config section.
+func newRetry(phase string, config RetryConfig) (Retry, error) {
+	retry := Retry{Retries: DefaultRetries, Backoff: DefaultBackoff}
+
+	if config.Retries != nil {
+		if *config.Retries < 0 {
+			return retry, fmt.Errorf("invalid %s retries, %d", phase, *config.Retries)
+		}
+
+		retry.Retries = *config.Retries
+	}
+
+	if config.Backoff != "" {
+		backoff, err := time.ParseDuration(config.Backoff)
+		if err != nil || backoff <= 0 {
+			return retry, fmt.Errorf("invalid %s backoff, %s", phase, config.Backoff)
+		}
+
+		retry.Backoff = backoff
+	}
+
+	return retry, nil
+}
+
+// delay returns how long to wait before retry n, counting from 0: the
+// backoff doubled n times, up to MaxBackoff, and then randomly cut by up to
+// half so that many hosts don't retry all at once.
+func (r Retry) delay(n int) time.Duration {
+	delay := r.Backoff
+	for i := 0; i < n && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > MaxBackoff {
+		delay = MaxBackoff
+	}
+
+	half := delay / 2
+
+	jitter, err := rand.Int(rand.Reader, big.NewInt(int64(half)+1))
+	if err != nil {
+		return delay
+	}
+
+	return half + time.Duration(jitter.Int64())
+}
+
+// do calls f until it succeeds or the retries run out, and returns the last
+// error.
+func (r Retry) do(f func() error) error {
+	err := f()
+
+	for n := 0; err != nil && n < r.Retries; n++ {
+		time.Sleep(r.delay(n))
+
+		err = f()
+	}
+
+	return err
+}
+
+// apiRetry is how to retry provider API requests that fail, as set with
+// "api_retry" in the config file.
+var apiRetry = Retry{Retries: DefaultRetries, Backoff: DefaultBackoff}
+
+// retryTransport retries requests that are rate limited, or fail with a
+// server or network error, within the deadline of their context.
+type retryTransport struct {
+	base  http.RoundTripper
+	retry Retry
+}
+
+// retryable reports whether the request that got resp or err can be sent
+// again. Only idempotent requests are retried after errors that may have
+// happened once the request was processed.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// rateLimitWait returns how long a rate limited response asks to wait, from
+// its Retry-After header or the RateLimit-Reset header of the DigitalOcean
+// API, a Unix time, if any.
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+
+		if date, err := http.ParseTime(value); err == nil {
+			return time.Until(date), true
+		}
+	}
+
+	if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+		return time.Until(time.Unix(reset, 0)), true
+	}
+
+	return 0, false
+}
+
+// RoundTrip sends req, and sends it again as set by t.retry while it fails.
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for n := 0; ; n++ {
+		resp, err := t.base.RoundTrip(req)
+		if n == t.retry.Retries || !retryable(req, resp, err) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := t.retry.delay(n)
+		if wait, ok := rateLimitWait(resp); ok {
+			delay = wait
+		}
+
+		// Give up at once rather than wait past the deadline.
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // hmac-sha1 is a standard TSIG algorithm.
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// RFC2136TTL is the TTL of new records set by dynamic updates.
+const RFC2136TTL = 300
+
+// TSIGFudge is the time difference, in seconds, allowed between TSIG signed
+// messages and the server clock.
+const TSIGFudge = 300
+
+// DNS message constants used by dynamic updates.
+const (
+	dnsTypeSOA   = 6
+	dnsTypeTSIG  = 250
+	dnsClassIN   = 1
+	dnsClassNone = 254
+	dnsClassAny  = 255
+
+	dnsOpcodeUpdate = 5
+
+	dnsRcodeNXDomain = 3
+	dnsRcodeNotAuth  = 9
+	dnsRcodeNotZone  = 10
+)
+
+// dnsTypes maps the record types do-dyndns can set to their DNS codes.
+var dnsTypes = map[string]uint16{"A": 1, "AAAA": 28, "TXT": 16, "CNAME": 5, "SRV": 33, "MX": 15}
+
+// dnsNameOffsets are the offsets of the host names in the data of the
+// record types that have one, by DNS code, after their 16-bit numbers.
+var dnsNameOffsets = map[uint16]int{5: 0, 33: 6, 15: 2}
+
+// dnsRcodes are the names of DNS response codes.
+var dnsRcodes = map[int]string{
+	1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+	6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+	16: "BADSIG", 17: "BADKEY", 18: "BADTIME",
+}
+
+// tsigAlgorithms maps TSIG algorithm names to their hash functions.
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1.":   sha1.New,
+	"hmac-sha256.": sha256.New,
+	"hmac-sha512.": sha512.New,
+}
+
+// RFC2136Config is the "rfc2136" section of the config file.
+type RFC2136Config struct {
+	// Server is the primary name server of the zones, as host or host:port.
+	Server string `json:"server"`
+	// KeyName, KeyAlgorithm and KeySecret are the TSIG key, as in the key
+	// statement of BIND or the output of tsig-keygen. KeyAlgorithm is
+	// "hmac-sha256" by default.
+	KeyName      string `json:"key_name"`
+	KeyAlgorithm string `json:"key_algorithm"`
+	KeySecret    string `json:"key_secret"`
+}
+
+// RFC2136 is a provider for name servers that accept RFC 2136 dynamic
+// updates signed with a TSIG key, such as BIND or Knot.
+type RFC2136 struct {
+	server    string
+	keyName   string
+	algorithm string
+	secret    []byte
+}
+
+// dnsRR is a resource record in a DNS message.
+type dnsRR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// newRFC2136 returns an RFC 2136 dynamic update provider.
+func newRFC2136(config RFC2136Config) (*RFC2136, error) {
+	if config.Server == "" {
+		return nil, errors.New("missing RFC 2136 server")
+	}
+
+	if config.KeyName == "" || config.KeySecret == "" {
+		return nil, errors.New("missing RFC 2136 TSIG key")
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(config.KeySecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TSIG key secret; %w", err)
+	}
+
+	if config.KeyAlgorithm == "" {
+		config.KeyAlgorithm = "hmac-sha256"
+	}
+
+	algorithm := canonicalName(config.KeyAlgorithm)
+	if _, ok := tsigAlgorithms[algorithm]; !ok {
+		return nil, fmt.Errorf("unsupported TSIG algorithm, %s", config.KeyAlgorithm)
+	}
+
+	server := config.Server
+	if _, _, err = net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	return &RFC2136{server: server, keyName: canonicalName(config.KeyName), algorithm: algorithm, secret: secret}, nil
+}
+
+// canonicalName returns name in lower case with a trailing dot.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// packName appends name in DNS wire format to buf, without compression.
+func packName(buf *bytes.Buffer, name string) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label != "" {
+			buf.WriteByte(byte(len(label)))
+			buf.WriteString(label)
+		}
+	}
+
+	buf.WriteByte(0)
+}
+
+// putUint16 appends 16-bit values to buf in network byte order.
+func putUint16(buf *bytes.Buffer, values ...uint16) {
+	for _, v := range values {
+		buf.Write([]byte{byte(v >> 8), byte(v)})
+	}
+}
+
+// putUint32 appends a 32-bit value to buf in network byte order.
+func putUint32(buf *bytes.Buffer, v uint32) {
+	putUint16(buf, uint16(v>>16), uint16(v))
+}
+
+// packRR appends a resource record to buf.
+func packRR(buf *bytes.Buffer, rr dnsRR) {
+	packName(buf, rr.Name)
+	putUint16(buf, rr.Type, rr.Class)
+	putUint32(buf, rr.TTL)
+	putUint16(buf, uint16(len(rr.Data)))
+	buf.Write(rr.Data)
+}
+
+// newMessage returns a DNS message with one question, which is the zone for
+// updates, and the given update (authority) records.
+func newMessage(opcode int, question dnsRR, updates []dnsRR) []byte {
+	var buf bytes.Buffer
+
+	id := make([]byte, 2)
+	_, _ = rand.Read(id)
+
+	buf.Write(id)
+	putUint16(&buf, uint16(opcode<<11), 1, 0, uint16(len(updates)), 0)
+
+	packName(&buf, question.Name)
+	putUint16(&buf, question.Type, question.Class)
+
+	for _, rr := range updates {
+		packRR(&buf, rr)
+	}
+
+	return buf.Bytes()
+}
+
+// tsigVariables returns the TSIG variables that are signed along with a
+// message.
+func (p *RFC2136) tsigVariables(timeSigned uint64, tsigError uint16) []byte {
+	var buf bytes.Buffer
+
+	packName(&buf, p.keyName)
+	putUint16(&buf, dnsClassAny)
+	putUint32(&buf, 0)
+	packName(&buf, p.algorithm)
+	putUint16(&buf, uint16(timeSigned>>32))
+	putUint32(&buf, uint32(timeSigned))
+	putUint16(&buf, TSIGFudge, tsigError, 0)
+
+	return buf.Bytes()
+}
+
+// mac returns the TSIG MAC of data.
+func (p *RFC2136) mac(data ...[]byte) []byte {
+	mac := hmac.New(tsigAlgorithms[p.algorithm], p.secret)
+
+	for _, d := range data {
+		mac.Write(d)
+	}
+
+	return mac.Sum(nil)
+}
+
+// sign appends a TSIG record to msg, and returns the signed message and its
+// MAC.
+func (p *RFC2136) sign(msg []byte) ([]byte, []byte) {
+	timeSigned := uint64(time.Now().Unix())
+	mac := p.mac(msg, p.tsigVariables(timeSigned, 0))
+
+	var rdata bytes.Buffer
+
+	packName(&rdata, p.algorithm)
+	putUint16(&rdata, uint16(timeSigned>>32))
+	putUint32(&rdata, uint32(timeSigned))
+	putUint16(&rdata, TSIGFudge, uint16(len(mac)))
+	rdata.Write(mac)
+	// The original ID, and no error or other data.
+	rdata.Write(msg[0:2])
+	putUint16(&rdata, 0, 0)
+
+	signed := bytes.NewBuffer(append([]byte{}, msg...))
+	packRR(signed, dnsRR{Name: p.keyName, Type: dnsTypeTSIG, Class: dnsClassAny, Data: rdata.Bytes()})
+
+	out := signed.Bytes()
+	binary.BigEndian.PutUint16(out[10:], binary.BigEndian.Uint16(out[10:])+1)
+
+	return out, mac
+}
+
+// exchange sends a signed message to the server over TCP, and returns the
+// answer records of its verified response.
+func (p *RFC2136) exchange(ctx context.Context, msg []byte) ([]dnsRR, int, error) {
+	signed, mac := p.sign(msg)
+
+	conn, err := newDialer("tcp", apiBindAddress).DialContext(ctx, "tcp", p.server)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(signed)))
+
+	if _, err = conn.Write(append(length, signed...)); err != nil {
+		return nil, 0, err
+	}
+
+	if _, err = io.ReadFull(conn, length); err != nil {
+		return nil, 0, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint16(length))
+
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, 0, err
+	}
+
+	return p.parseResponse(resp, msg[0:2], mac)
+}
+
+// parseResponse checks the TSIG signature of a response to a request with
+// id and MAC, and returns its answer records and response code.
+func (p *RFC2136) parseResponse(resp, id, requestMAC []byte) ([]dnsRR, int, error) {
+	if len(resp) < 12 || !bytes.Equal(resp[0:2], id) {
+		return nil, 0, errors.New("invalid DNS response")
+	}
+
+	rcode := int(resp[3] & 0x0f)
+	counts := []int{
+		int(binary.BigEndian.Uint16(resp[4:])), int(binary.BigEndian.Uint16(resp[6:])),
+		int(binary.BigEndian.Uint16(resp[8:])), int(binary.BigEndian.Uint16(resp[10:])),
+	}
+
+	off := 12
+
+	for i := 0; i < counts[0]; i++ {
+		var err error
+
+		if _, off, err = readName(resp, off); err != nil {
+			return nil, 0, err
+		}
+
+		off += 4
+	}
+
+	var (
+		answers []dnsRR
+		tsig    *dnsRR
+		start   int
+	)
+
+	for section, count := range counts[1:] {
+		for i := 0; i < count; i++ {
+			rrStart := off
+
+			rr, next, err := readRR(resp, off)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			switch {
+			case section == 0:
+				answers = append(answers, rr)
+			case section == 2 && rr.Type == dnsTypeTSIG && next == len(resp):
+				tsig, start = &rr, rrStart
+			}
+
+			off = next
+		}
+	}
+
+	if tsig == nil {
+		if rcode == dnsRcodeNotAuth {
+			return nil, rcode, fmt.Errorf("%w, the server rejected the TSIG key", ErrUnauthorized)
+		}
+
+		return nil, rcode, errors.New("unsigned DNS response")
+	}
+
+	if err := p.verify(resp[:start], *tsig, requestMAC); err != nil {
+		return nil, rcode, err
+	}
+
+	return answers, rcode, nil
+}
+
+// verify checks the TSIG record of a response, whose other records are msg.
+func (p *RFC2136) verify(msg []byte, tsig dnsRR, requestMAC []byte) error {
+	data := tsig.Data
+
+	_, off, err := readName(data, 0)
+	if err != nil || len(data) < off+10 {
+		return errors.New("invalid TSIG record")
+	}
+
+	timeSigned := uint64(binary.BigEndian.Uint16(data[off:]))<<32 | uint64(binary.BigEndian.Uint32(data[off+2:]))
+	macSize := int(binary.BigEndian.Uint16(data[off+8:]))
+
+	if len(data) < off+10+macSize+6 {
+		return errors.New("invalid TSIG record")
+	}
+
+	mac := data[off+10 : off+10+macSize]
+
+	if tsigError := binary.BigEndian.Uint16(data[off+10+macSize+2:]); tsigError != 0 {
+		return fmt.Errorf("%w, TSIG error %s", ErrUnauthorized, dnsRcodes[int(tsigError)])
+	}
+
+	// The response is signed as it was before adding the TSIG record.
+	unsigned := append([]byte{}, msg...)
+	binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(unsigned[10:])-1)
+
+	size := []byte{byte(len(requestMAC) >> 8), byte(len(requestMAC))}
+	want := p.mac(size, requestMAC, unsigned, p.tsigVariables(timeSigned, 0))
+
+	if !hmac.Equal(mac, want) {
+		return errors.New("bad TSIG signature in DNS response")
+	}
+
+	return nil
+}
+
+// readName reads a possibly compressed domain name at off in msg, and
+// returns it and the offset after it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+
+	end := -1
+
+	for jumps := 0; jumps < 64; {
+		if off >= len(msg) {
+			break
+		}
+
+		size := int(msg[off])
+
+		switch {
+		case size == 0:
+			if end < 0 {
+				end = off + 1
+			}
+
+			return strings.Join(labels, ".") + ".", end, nil
+		case size&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("invalid DNS name")
+			}
+
+			if end < 0 {
+				end = off + 2
+			}
+
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+size > len(msg) {
+				return "", 0, errors.New("invalid DNS name")
+			}
+
+			labels = append(labels, string(msg[off+1:off+1+size]))
+			off += 1 + size
+		}
+	}
+
+	return "", 0, errors.New("invalid DNS name")
+}
+
+// readRR reads a resource record at off in msg, and returns it and the
+// offset after it.
+func readRR(msg []byte, off int) (dnsRR, int, error) {
+	name, off, err := readName(msg, off)
+	if err != nil {
+		return dnsRR{}, 0, err
+	}
+
+	if len(msg) < off+10 {
+		return dnsRR{}, 0, errors.New("invalid DNS record")
+	}
+
+	rr := dnsRR{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(msg[off:]),
+		Class: binary.BigEndian.Uint16(msg[off+2:]),
+		TTL:   binary.BigEndian.Uint32(msg[off+4:]),
+	}
+
+	size := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+
+	if len(msg) < off+size {
+		return dnsRR{}, 0, errors.New("invalid DNS record")
+	}
+
+	rr.Data = msg[off : off+size]
+
+	// Host names in the data may be compressed, pointing elsewhere in msg;
+	// they are expanded so that the data stands on its own.
+	if nameOffset, ok := dnsNameOffsets[rr.Type]; ok && nameOffset < size {
+		target, _, err := readName(msg, off+nameOffset)
+		if err != nil {
+			return dnsRR{}, 0, err
+		}
+
+		var data bytes.Buffer
+
+		data.Write(rr.Data[:nameOffset])
+		packName(&data, target)
+		rr.Data = data.Bytes()
+	}
+
+	return rr, off + size, nil
+}
+
+// rdata returns the wire format of the data of a record.
+func rdata(record DNSRecord) (uint16, []byte, error) {
+	recordType, ok := dnsTypes[record.Type]
+	if !ok {
+		return 0, nil, fmt.Errorf("unsupported record type for RFC 2136, %s", record.Type)
+	}
+
+	switch record.Type {
+	case "TXT":
+		return recordType, txtData(record.Data), nil
+	case "CNAME", "SRV", "MX":
+		var data bytes.Buffer
+
+		numbers, target := dataFields(record.Type, record.Data)
+		for _, number := range numbers {
+			putUint16(&data, uint16(number))
+		}
+
+		packName(&data, target)
+
+		return recordType, data.Bytes(), nil
+	}
+
+	ip := net.ParseIP(record.Data)
+	if ip == nil {
+		return 0, nil, fmt.Errorf("invalid IP address, %s", record.Data)
+	}
+
+	if recordType == dnsTypes["A"] {
+		return recordType, ip.To4(), nil
+	}
+
+	return recordType, ip.To16(), nil
+}
+
+// txtData returns the wire format of TXT data, as strings of up to
+// MaxTXTString bytes, each prefixed with its length.
+func txtData(text string) []byte {
+	var data []byte
+
+	for {
+		chunk := text
+		if len(chunk) > MaxTXTString {
+			chunk = chunk[:MaxTXTString]
+		}
+
+		data = append(append(data, byte(len(chunk))), chunk...)
+
+		if len(text) <= MaxTXTString {
+			return data
+		}
+
+		text = text[MaxTXTString:]
+	}
+}
+
+// rdataValue returns the data of a record of type code from its wire
+// format: the address, the numbers and host name, or the joined strings of
+// TXT data.
+func rdataValue(code uint16, data []byte) string {
+	if nameOffset, ok := dnsNameOffsets[code]; ok && nameOffset < len(data) {
+		var numbers []int
+
+		for i := 0; i < nameOffset; i += 2 {
+			numbers = append(numbers, int(binary.BigEndian.Uint16(data[i:])))
+		}
+
+		target, _, _ := readName(data, nameOffset)
+
+		return joinData(numbers, strings.TrimSuffix(target, "."))
+	}
+
+	if code != dnsTypes["TXT"] {
+		return net.IP(data).String()
+	}
+
+	var text []byte
+
+	for len(data) > 0 && int(data[0]) < len(data) {
+		size := 1 + int(data[0])
+		text = append(text, data[1:size]...)
+		data = data[size:]
+	}
+
+	return string(text)
+}
+
+// update sends a dynamic update with the given update records to the zone
+// for domain.
+func (p *RFC2136) update(ctx context.Context, domain string, updates ...dnsRR) error {
+	msg := newMessage(dnsOpcodeUpdate, dnsRR{Name: domain, Type: dnsTypeSOA, Class: dnsClassIN}, updates)
+
+	_, rcode, err := p.exchange(ctx, msg)
+
+	switch {
+	case err != nil:
+		return err
+	case rcode == dnsRcodeNotAuth || rcode == dnsRcodeNotZone:
+		return fmt.Errorf("%w on RFC 2136 server %s: %s", ErrDomainNotFound, p.server, domain)
+	case rcode != 0:
+		return fmt.Errorf("dynamic update refused by %s, %s", p.server, dnsRcodes[rcode])
+	}
+
+	return nil
+}
+
+// Records returns the records in domain with the given type and name, as
+// answered by the server.
+func (p *RFC2136) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	code, ok := dnsTypes[recordType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type for RFC 2136, %s", recordType)
+	}
+
+	fqdn := canonicalName(absoluteName(name, domain))
+
+	answers, rcode, err := p.exchange(ctx, newMessage(0, dnsRR{Name: fqdn, Type: code, Class: dnsClassIN}, nil))
+
+	switch {
+	case err != nil:
+		return nil, err
+	case rcode == dnsRcodeNXDomain:
+		return nil, nil
+	case rcode == dnsRcodeNotAuth || rcode == dnsRcodeNotZone:
+		return nil, fmt.Errorf("%w on RFC 2136 server %s: %s", ErrDomainNotFound, p.server, domain)
+	case rcode != 0:
+		return nil, fmt.Errorf("query refused by %s, %s", p.server, dnsRcodes[rcode])
+	}
+
+	var records []DNSRecord
+
+	for _, rr := range answers {
+		if rr.Type == code && strings.EqualFold(rr.Name, fqdn) {
+			value := rdataValue(code, rr.Data)
+			records = append(records, DNSRecord{ID: value, Type: recordType, Name: name, Data: value, TTL: int(rr.TTL)})
+		}
+	}
+
+	return records, nil
+}
+
+// CreateRecord adds a record to domain and returns it as created.
+func (p *RFC2136) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	recordType, data, err := rdata(record)
+	if err != nil {
+		return record, err
+	}
+
+	if record.TTL == 0 {
+		record.TTL = RFC2136TTL
+	}
+
+	add := dnsRR{
+		Name: absoluteName(record.Name, domain), Type: recordType, Class: dnsClassIN, TTL: uint32(record.TTL), Data: data,
+	}
+
+	if err = p.update(ctx, domain, add); err != nil {
+		return record, err
+	}
+
+	record.ID = record.Data
+
+	return record, nil
+}
+
+// UpdateRecord replaces the value of an existing record in domain, in a
+// single update.
+func (p *RFC2136) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	recordType, data, err := rdata(record)
+	if err != nil {
+		return err
+	}
+
+	_, old, err := rdata(DNSRecord{Type: record.Type, Data: record.ID})
+	if err != nil {
+		return err
+	}
+
+	if record.TTL == 0 {
+		record.TTL = RFC2136TTL
+	}
+
+	name := absoluteName(record.Name, domain)
+
+	return p.update(ctx, domain,
+		dnsRR{Name: name, Type: recordType, Class: dnsClassNone, Data: old},
+		dnsRR{Name: name, Type: recordType, Class: dnsClassIN, TTL: uint32(record.TTL), Data: data})
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *RFC2136) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	recordType, data, err := rdata(DNSRecord{Type: record.Type, Data: record.ID})
+	if err != nil {
+		return err
+	}
+
+	return p.update(ctx, domain,
+		dnsRR{Name: absoluteName(record.Name, domain), Type: recordType, Class: dnsClassNone, Data: data})
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// setMember is a record of a round-robin set, with the public IP addresses
+// detected for its uplink, if any.
+type setMember struct {
+	record Record
+	ips    PublicIPs
+}
+
+// setKey returns the key of the round-robin set of a record. Records of the
+// same provider, type and name make up a set, set together, so that each
+// can publish the address of a different uplink or site.
+func setKey(record Record) string {
+	return fmt.Sprintf("%s %s %s",
+		record.Provider, strings.ToUpper(record.Type), strings.ToLower(strings.TrimSuffix(record.String(), ".")))
+}
+
+// roundRobinSets returns the keys of the round-robin sets of records, those
+// of more than one record.
+func roundRobinSets(records []Record) map[string]bool {
+	count := map[string]int{}
+
+	for _, record := range records {
+		count[setKey(record)]++
+	}
+
+	sets := map[string]bool{}
+
+	for key, n := range count {
+		if n > 1 {
+			sets[key] = true
+		}
+	}
+
+	return sets
+}
+
+// setRoundRobin sets the round-robin sets with the given keys, in order,
+// each to the addresses of its members. A member without an address has its
+// address removed from the set, unless no member has an address, and then
+// the set is left alone. It returns the same values as setSubdomainRecords.
+func setRoundRobin(
+	providers Providers, keys []string, members map[string][]setMember, policy Policy,
+) (ok bool, minTTL int, firstErr error) {
+	ok = true
+
+	for _, key := range keys {
+		var types []string
+
+		data := map[string][]string{}
+		wants := map[string]DNSRecord{}
+
+		for _, member := range members[key] {
+			memberWants, memberOK := recordWants(member.record, member.ips)
+			ok = ok && memberOK
+
+			for _, want := range memberWants {
+				if _, found := wants[want.Type]; !found {
+					types = append(types, want.Type)
+					wants[want.Type] = want
+				}
+
+				if dataIndex(want.Type, data[want.Type], want.Data) < 0 {
+					data[want.Type] = append(data[want.Type], want.Data)
+				}
+			}
+		}
+
+		record := members[key][0].record
+		setOK := true
+
+		for _, recordType := range types {
+			set := data[recordType]
+			sort.Strings(set)
+
+			// The state remembers the whole set as the data of the record.
+			want := wants[recordType]
+			want.Data = strings.Join(set, " ")
+
+			wantOK, ttl, err := setRecord(providers, record, want, policy,
+				func(provider Provider, domain string, setWant DNSRecord, setPolicy Policy) (string, int, error) {
+					return setRecordSet(provider, domain, setWant, set, setPolicy)
+				})
+			ok, setOK = ok && wantOK, setOK && wantOK
+
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+
+			if ttl > 0 && (minTTL == 0 || ttl < minTTL) {
+				minTTL = ttl
+			}
+		}
+
+		var setWants []DNSRecord
+
+		for _, recordType := range types {
+			setWants = append(setWants, wants[recordType])
+		}
+
+		if pruneOK, err := pruneOtherFamily(providers, record, setWants, setOK, policy); err != nil {
+			ok = false
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			ok = ok && pruneOK
+		}
+	}
+
+	return ok, minTTL, firstErr
+}
+
+// dataIndex returns the index of data in set, or -1 if not found.
+func dataIndex(recordType string, set []string, data string) int {
+	for i, other := range set {
+		if sameData(recordType, other, data) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// setRecordSet sets the records in domain with the type and name of want to
+// the data in set, as a round-robin set: records with other data are updated
+// to the missing data, or deleted if there are too many, and the rest of
+// the missing data is created. Records of StaticTypes with other data are
+// left alone instead, since they may be set elsewhere.
+// Changes are written as they are made, so no action is returned, only the
+// TTL of the records.
+func setRecordSet(provider Provider, domain string, want DNSRecord, set []string, policy Policy) (string, int, error) {
+	if updateOnly, ok := provider.(*UpdateOnly); ok {
+		return "", 0, fmt.Errorf("round-robin sets cannot be set with %s", updateOnly.name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+
+	matches, err := provider.Records(ctx, domain, want.Type, want.Name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	fqdn := Record{Name: want.Name, Domain: domain}
+	missing := append([]string(nil), set...)
+	ttl := want.TTL
+
+	var stale []DNSRecord
+
+	for _, record := range matches {
+		i := dataIndex(want.Type, missing, record.Data)
+		if i < 0 {
+			stale = append(stale, record)
+
+			continue
+		}
+
+		missing = append(missing[:i], missing[i+1:]...)
+
+		if ttl == 0 {
+			ttl = record.TTL
+		}
+
+		if !policy.Force && record.Proxied == want.Proxied && want.hasTTL(record.TTL) {
+			continue
+		}
+
+		record.Proxied = want.Proxied
+
+		if want.TTL > 0 {
+			record.TTL = want.TTL
+		}
+
+		if err = provider.UpdateRecord(ctx, domain, record); err != nil {
+			return "", 0, err
+		}
+
+		writeOut(fmt.Sprintf("updated %s %s for %s", want.Type, record.Data, fqdn))
+	}
+
+	for _, record := range stale {
+		switch {
+		case StaticTypes[want.Type]:
+			continue
+		case len(missing) == 0:
+			if err = provider.DeleteRecord(ctx, domain, record); err != nil {
+				return "", 0, err
+			}
+
+			writeOut(fmt.Sprintf("deleted %s %s for %s", want.Type, record.Data, fqdn))
+
+			continue
+		}
+
+		record.Data, record.Proxied, missing = missing[0], want.Proxied, missing[1:]
+
+		if want.TTL > 0 {
+			record.TTL = want.TTL
+		}
+
+		if err = provider.UpdateRecord(ctx, domain, record); err != nil {
+			return "", 0, err
+		}
+
+		writeOut(fmt.Sprintf("updated %s %s for %s", want.Type, record.Data, fqdn))
+
+		if policy.Verify {
+			verifyRecord(provider, domain, record, record.Data, policy.Timeout)
+		}
+	}
+
+	for _, data := range missing {
+		record := want
+		record.Data = data
+
+		var created DNSRecord
+
+		if created, err = provider.CreateRecord(ctx, domain, record); err != nil {
+			return "", 0, err
+		}
+
+		if ttl == 0 {
+			ttl = created.TTL
+		}
+
+		writeOut(fmt.Sprintf("created %s %s for %s", want.Type, data, fqdn))
+
+		if policy.Verify {
+			verifyRecord(provider, domain, created, data, policy.Timeout)
+		}
+	}
+
+	return "", ttl, nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Route53API is the base URL of the Route 53 API.
+const Route53API = "https://route53.amazonaws.com/2013-04-01"
+
+// Route53TTL is the TTL of new Route 53 records, which have no default.
+const Route53TTL = 300
+
+// Route53Config is the "route53" section of the config file.
+type Route53Config struct {
+	AWSConfig
+	// Zones maps domains to hosted zone IDs. Domains not listed here are
+	// looked up by name.
+	Zones map[string]string `json:"zones"`
+}
+
+// Route53 is the AWS Route 53 DNS provider.
+type Route53 struct {
+	client *http.Client
+	creds  AWSConfig
+	// zones caches hosted zone IDs by domain.
+	zones map[string]string
+}
+
+// route53RecordSet is a resource record set in the Route 53 API.
+type route53RecordSet struct {
+	Name    string          `xml:"Name"`
+	Type    string          `xml:"Type"`
+	TTL     int             `xml:"TTL"`
+	Records []route53Record `xml:"ResourceRecords>ResourceRecord"`
+}
+
+// route53Record is a single value of a record set.
+type route53Record struct {
+	Value string `xml:"Value"`
+}
+
+// newRoute53 returns a Route 53 provider.
+func newRoute53(config Route53Config) (*Route53, error) {
+	creds, err := config.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	zones := map[string]string{}
+	for domain, id := range config.Zones {
+		zones[domain] = strings.TrimPrefix(id, "/hostedzone/")
+	}
+
+	return &Route53{client: newAPIClient(), creds: creds, zones: zones}, nil
+}
+
+// request sends a signed request to the Route 53 API and decodes the XML
+// response into out, if not nil.
+func (p *Route53) request(ctx context.Context, method, path string, body, out interface{}) error {
+	var content []byte
+
+	if body != nil {
+		var err error
+
+		content, err = xml.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		content = append([]byte(xml.Header), content...)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, Route53API+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+
+	signAWS(req, content, p.creds, "us-east-1", "route53", time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	content, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w, check the AWS access key and its Route 53 permissions", ErrUnauthorized)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(content))}
+	case out == nil:
+		return nil
+	}
+
+	return xml.Unmarshal(content, out)
+}
+
+// zoneID returns the hosted zone ID for domain.
+func (p *Route53) zoneID(ctx context.Context, domain string) (string, error) {
+	if id, ok := p.zones[domain]; ok {
+		return id, nil
+	}
+
+	var resp struct {
+		HostedZones []struct {
+			ID   string `xml:"Id"`
+			Name string `xml:"Name"`
+		} `xml:"HostedZones>HostedZone"`
+	}
+
+	target := "/hostedzonesbyname?maxitems=1&dnsname=" + url.QueryEscape(domain)
+	if err := p.request(ctx, http.MethodGet, target, nil, &resp); err != nil {
+		return "", err
+	}
+
+	// Zones are listed in order starting at dnsname, which may not exist.
+	if len(resp.HostedZones) == 0 || resp.HostedZones[0].Name != domain+"." {
+		return "", fmt.Errorf("%w in Route 53 account: %s", ErrDomainNotFound, domain)
+	}
+
+	id := strings.TrimPrefix(resp.HostedZones[0].ID, "/hostedzone/")
+	p.zones[domain] = id
+
+	return id, nil
+}
+
+// recordSet returns the record set with the given type and name in a zone,
+// or nil if there is none.
+func (p *Route53) recordSet(ctx context.Context, zone, recordType, name string) (*route53RecordSet, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("type", recordType)
+	query.Set("maxitems", "1")
+
+	var resp struct {
+		RecordSets []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+
+	if err := p.request(ctx, http.MethodGet, "/hostedzone/"+zone+"/rrset?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	// Record sets are listed in order starting at name, which may not exist.
+	// Route 53 escapes the "*" of wildcard names in octal.
+	if len(resp.RecordSets) == 0 || resp.RecordSets[0].Type != recordType ||
+		strings.Replace(resp.RecordSets[0].Name, `\052`, "*", 1) != name {
+		return nil, nil
+	}
+
+	return &resp.RecordSets[0], nil
+}
+
+// change applies a single change, UPSERT or DELETE, to a record set.
+func (p *Route53) change(ctx context.Context, zone, action string, set *route53RecordSet) error {
+	type change struct {
+		Action    string           `xml:"Action"`
+		RecordSet route53RecordSet `xml:"ResourceRecordSet"`
+	}
+
+	body := struct {
+		XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+		Changes []change `xml:"ChangeBatch>Changes>Change"`
+	}{
+		Changes: []change{{Action: action, RecordSet: *set}},
+	}
+
+	return p.request(ctx, http.MethodPost, "/hostedzone/"+zone+"/rrset/", body, nil)
+}
+
+// Records returns the records in domain with the given type and name.
+// Route 53 groups records with the same name and type in a record set; each
+// value is returned as a separate record, with the value itself as its ID.
+func (p *Route53) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := p.recordSet(ctx, zone, recordType, absoluteName(name, domain)+".")
+	if err != nil || set == nil {
+		return nil, err
+	}
+
+	records := make([]DNSRecord, 0, len(set.Records))
+
+	for _, value := range set.Records {
+		records = append(records, DNSRecord{
+			ID: value.Value, Type: recordType, Name: name, Data: parseZoneData(recordType, value.Value), TTL: set.TTL,
+		})
+	}
+
+	return records, nil
+}
+
+// CreateRecord adds a record to its record set in domain, creating the set
+// if needed, and returns it as created.
+func (p *Route53) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	if err := p.replaceValue(ctx, domain, record, ""); err != nil {
+		return record, err
+	}
+
+	record.ID = zoneData(record.Type, record.Data)
+
+	if record.TTL == 0 {
+		record.TTL = Route53TTL
+	}
+
+	return record, nil
+}
+
+// UpdateRecord replaces the value of an existing record in domain.
+func (p *Route53) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	return p.replaceValue(ctx, domain, record, record.ID)
+}
+
+// replaceValue upserts the record set of record, replacing the value old
+// with the record data; if old is empty, the data is added to the set.
+func (p *Route53) replaceValue(ctx context.Context, domain string, record DNSRecord, old string) error {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	name := absoluteName(record.Name, domain) + "."
+
+	set, err := p.recordSet(ctx, zone, record.Type, name)
+	if err != nil {
+		return err
+	}
+
+	if set == nil {
+		set = &route53RecordSet{Name: name, Type: record.Type, TTL: Route53TTL}
+	}
+
+	if record.TTL > 0 {
+		set.TTL = record.TTL
+	}
+
+	data := zoneData(record.Type, record.Data)
+	values := []route53Record{{Value: data}}
+
+	for _, value := range set.Records {
+		if value.Value != old && value.Value != data {
+			values = append(values, value)
+		}
+	}
+
+	set.Records = values
+
+	return p.change(ctx, zone, "UPSERT", set)
+}
+
+// DeleteRecord removes a record from its record set in domain, deleting
+// the set if it was its last value.
+func (p *Route53) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	zone, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	set, err := p.recordSet(ctx, zone, record.Type, absoluteName(record.Name, domain)+".")
+	if err != nil {
+		return err
+	}
+
+	if set == nil {
+		return errors.New("record set not found")
+	}
+
+	var values []route53Record
+
+	for _, value := range set.Records {
+		if value.Value != record.ID {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		// Route 53 deletes a record set only if it matches exactly.
+		return p.change(ctx, zone, "DELETE", set)
+	}
+
+	set.Records = values
+
+	return p.change(ctx, zone, "UPSERT", set)
+}
+
+// Domains returns the names of all the hosted zones in the account.
+func (p *Route53) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	path := "/hostedzone"
+
+	for {
+		var resp struct {
+			HostedZones []struct {
+				Name string `xml:"Name"`
+			} `xml:"HostedZones>HostedZone"`
+			IsTruncated bool   `xml:"IsTruncated"`
+			NextMarker  string `xml:"NextMarker"`
+		}
+
+		if err := p.request(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, zone := range resp.HostedZones {
+			names = append(names, strings.TrimSuffix(zone.Name, "."))
+		}
+
+		if !resp.IsTruncated {
+			return names, nil
+		}
+
+		path = "/hostedzone?marker=" + url.QueryEscape(resp.NextMarker)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateMaxAge is how long the state of a record is trusted, unless set
+// otherwise in the config file, before asking the provider again, in case
+// the record was changed elsewhere.
+const StateMaxAge = 24 * time.Hour
+
+// PublishedRecord is the state of a record as last set.
+type PublishedRecord struct {
+	Data    string    `json:"data"`
+	Proxied bool      `json:"proxied"`
+	TTL     int       `json:"ttl"`
+	Checked time.Time `json:"checked"`
+}
+
+// State is the state of the records as last set, so that runs where nothing
+// changed need no provider API calls, and of the records prepared for an
+// address change.
+type State struct {
+	path     string
+	maxAge   time.Duration
+	changed  bool
+	Records  map[string]PublishedRecord `json:"records"`
+	Prepared map[string]PreparedRecord  `json:"prepared,omitempty"`
+}
+
+// stateDir returns the user state directory: $XDG_STATE_HOME, or else
+// $HOME/.local/state.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// stateFile returns the name of the state file of the config file, in the
+// user state directory, so that instances with different config files keep
+// their own state.
+func stateFile(configFile string) string {
+	if configFile != "" {
+		if abs, err := filepath.Abs(configFile); err == nil {
+			configFile = abs
+		}
+	}
+
+	sum := sha256.Sum256([]byte(configFile))
+
+	return fmt.Sprintf("state-%x.json", sum[:8])
+}
+
+// parseStateMaxAge parses the "state_max_age" of the config file, or returns
+// StateMaxAge if text is empty.
+func parseStateMaxAge(text string) (time.Duration, error) {
+	if text == "" {
+		return StateMaxAge, nil
+	}
+
+	maxAge, err := time.ParseDuration(text)
+	if err != nil || maxAge < 0 {
+		return 0, fmt.Errorf("invalid state max age, %s", text)
+	}
+
+	return maxAge, nil
+}
+
+// loadState reads the state file of the config file. A missing or
+// unreadable file is an empty state, so that all records are checked with
+// their providers. With a max age of 0, records as last set are not
+// remembered.
+func loadState(configFile string, maxAge time.Duration) *State {
+	state := &State{maxAge: maxAge}
+
+	dir, err := stateDir()
+	if err != nil {
+		return state
+	}
+
+	state.path = filepath.Join(dir, Prog, stateFile(configFile))
+
+	if content, err := os.ReadFile(state.path); err == nil {
+		_ = json.Unmarshal(content, state)
+	}
+
+	if state.Records == nil || maxAge == 0 {
+		state.Records = map[string]PublishedRecord{}
+	}
+
+	if state.Prepared == nil {
+		state.Prepared = map[string]PreparedRecord{}
+	}
+
+	return state
+}
+
+// stateKey returns the key of a record of provider in the state, as set to
+// want.
+func stateKey(provider string, record Record, want DNSRecord) string {
+	return fmt.Sprintf("%s %s %s", provider, want.Type, record)
+}
+
+// published returns the TTL of the record with key, if it was last set as
+// want within the max age.
+func (s *State) published(key string, want DNSRecord) (int, bool) {
+	if s == nil {
+		return 0, false
+	}
+
+	record, ok := s.Records[key]
+	if !ok || record.Data != want.Data || record.Proxied != want.Proxied || !want.hasTTL(record.TTL) ||
+		time.Since(record.Checked) > s.maxAge {
+		return 0, false
+	}
+
+	return record.TTL, true
+}
+
+// publish remembers that the record with key is set as want, or forgets it
+// if it could not be set.
+func (s *State) publish(key string, want DNSRecord, ttl int, err error) {
+	if s == nil || s.maxAge == 0 {
+		return
+	}
+
+	if err != nil {
+		if _, ok := s.Records[key]; ok {
+			delete(s.Records, key)
+
+			s.changed = true
+		}
+
+		return
+	}
+
+	s.Records[key] = PublishedRecord{Data: want.Data, Proxied: want.Proxied, TTL: ttl, Checked: time.Now()}
+	s.changed = true
+}
+
+// save writes the state file, if the state changed.
+func (s *State) save() error {
+	if s == nil || !s.changed || s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	// Replace the file at once, with a temporary file of its own, in case
+	// of concurrent runs.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.changed = false
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// STUN message and attribute types, from RFC 5389.
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingResponse  = 0x0101
+	stunBindingError     = 0x0111
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+	stunMagicCookie      = 0x2112A442
+	stunHeaderSize       = 20
+)
+
+// STUNRetransmit is how long to wait for a STUN response before sending
+// the request again, as UDP datagrams can be lost.
+const STUNRetransmit = 500 * time.Millisecond
+
+// STUNDetector asks a STUN server for the address that the machine sends
+// UDP datagrams from. It works behind NATs where web detection services are
+// blocked.
+type STUNDetector struct {
+	// Server is the host and port of the STUN server.
+	Server string
+}
+
+// Detect returns the public IP address reported by the STUN server.
+func (d STUNDetector) Detect(ctx context.Context, ipv6 bool, bindAddress net.IP) (net.IP, error) {
+	network := "udp4"
+	if ipv6 {
+		network = "udp6"
+	}
+
+	conn, err := newDialer(network, bindAddress).DialContext(ctx, network, d.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+
+	if _, err = rand.Read(request[8:]); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 1500)
+
+	var n int
+
+	for {
+		if _, err = conn.Write(request); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(STUNRetransmit)
+		if end, ok := ctx.Deadline(); ok && end.Before(deadline) {
+			deadline = end
+		}
+
+		if err = conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+
+		n, err = conn.Read(response)
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Ignore stray datagrams, e.g. late answers to a previous request.
+		if n < stunHeaderSize || !bytes.Equal(response[4:stunHeaderSize], request[4:]) {
+			continue
+		}
+
+		return parseSTUNResponse(response[:n])
+	}
+}
+
+// parseSTUNResponse returns the mapped address in a STUN binding response.
+func parseSTUNResponse(msg []byte) (net.IP, error) {
+	switch binary.BigEndian.Uint16(msg[0:]) {
+	case stunBindingResponse:
+	case stunBindingError:
+		return nil, errors.New("binding request rejected")
+	default:
+		return nil, errors.New("unexpected STUN response")
+	}
+
+	var mapped net.IP
+
+	attrs := msg[stunHeaderSize:]
+	if length := int(binary.BigEndian.Uint16(msg[2:])); length < len(attrs) {
+		attrs = attrs[:length]
+	}
+
+	for len(attrs) >= 4 {
+		attrType, length := binary.BigEndian.Uint16(attrs[0:]), int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+length > len(attrs) {
+			break
+		}
+
+		value := attrs[4 : 4+length]
+
+		switch attrType {
+		case stunXORMappedAddress:
+			if ip := stunAddress(value); ip != nil {
+				// The address is XORed with the magic cookie and the
+				// transaction ID, which follow it in the header.
+				for i := range ip {
+					ip[i] ^= msg[4+i]
+				}
+
+				return ip, nil
+			}
+		case stunMappedAddress:
+			mapped = stunAddress(value)
+		}
+
+		// Attributes are padded to a multiple of 4 bytes.
+		next := 4 + (length+3)&^3
+		if next > len(attrs) {
+			break
+		}
+
+		attrs = attrs[next:]
+	}
+
+	// Old RFC 3489 servers only send MAPPED-ADDRESS.
+	if mapped != nil {
+		return mapped, nil
+	}
+
+	return nil, errors.New("no mapped address in STUN response")
+}
+
+// stunAddress returns the IP address in a (XOR-)MAPPED-ADDRESS attribute
+// value, or nil if malformed.
+func stunAddress(value []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	size := map[byte]int{0x01: net.IPv4len, 0x02: net.IPv6len}[value[1]]
+	if size == 0 || len(value) < 4+size {
+		return nil
+	}
+
+	return append(net.IP{}, value[4:4+size]...)
+}
+
+// String returns the STUN server.
+func (d STUNDetector) String() string {
+	return fmt.Sprintf("STUN server %s", d.Server)
+}
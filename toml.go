@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TOML values other than strings, arrays and tables. Dates and times are
+// read as strings.
+var (
+	tomlInt      = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$`)
+	tomlOtherInt = regexp.MustCompile(`^(0x[0-9a-fA-F](_?[0-9a-fA-F])*|0o[0-7](_?[0-7])*|0b[01](_?[01])*)$`)
+	tomlFloat    = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+	tomlDate     = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}|[0-9]{2}:[0-9]{2}:[0-9]{2})`)
+)
+
+// tomlParser parses a TOML document, from start to end.
+type tomlParser struct {
+	text string
+	pos  int
+	// defined are the tables defined by their headers, which cannot be
+	// defined again.
+	defined map[uintptr]bool
+}
+
+// tomlToJSON converts a TOML document to JSON, so that config files in TOML
+// are read with the same settings: tables are JSON objects, and arrays of
+// tables arrays of objects.
+func tomlToJSON(content []byte) ([]byte, error) {
+	p := &tomlParser{text: strings.ReplaceAll(string(content), "\r\n", "\n"), defined: map[uintptr]bool{}}
+
+	root := map[string]interface{}{}
+	table := root
+
+	for {
+		p.skipBlank(true)
+
+		if p.pos == len(p.text) {
+			break
+		}
+
+		var err error
+
+		switch {
+		case strings.HasPrefix(p.text[p.pos:], "[["):
+			p.pos += 2
+			table, err = p.parseHeader(root, "]]")
+		case p.text[p.pos] == '[':
+			p.pos++
+			table, err = p.parseHeader(root, "]")
+		default:
+			err = p.parseKeyValue(table)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// errorf returns an error at the current line of the document.
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml: line %d: %s", strings.Count(p.text[:p.pos], "\n")+1, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next character, or 0 at the end.
+func (p *tomlParser) peek() byte {
+	if p.pos == len(p.text) {
+		return 0
+	}
+
+	return p.text[p.pos]
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+// skipBlank skips white space and comments, and with newlines, also the
+// ends of lines.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || (newlines && c == '\n'):
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.text) && p.text[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine skips the rest of the line, which must be blank or a comment.
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+
+	if c := p.peek(); c != 0 && c != '\n' {
+		return p.errorf("expected the end of the line")
+	}
+
+	return nil
+}
+
+// parseHeader parses the header of a table, up to end, "]" for tables and
+// "]]" for arrays of tables, and returns the table.
+func (p *tomlParser) parseHeader(root map[string]interface{}, end string) (map[string]interface{}, error) {
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	if !strings.HasPrefix(p.text[p.pos:], end) {
+		return nil, p.errorf("expected %s after the table name", end)
+	}
+
+	p.pos += len(end)
+
+	if end == "]" {
+		table, tableErr := p.table(root, keys)
+		if tableErr != nil {
+			return nil, tableErr
+		}
+
+		id := reflect.ValueOf(table).Pointer()
+		if p.defined[id] {
+			return nil, p.errorf("duplicate table %s", strings.Join(keys, "."))
+		}
+
+		p.defined[id] = true
+
+		return table, nil
+	}
+
+	parent, err := p.table(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name := keys[len(keys)-1]
+
+	tables, ok := parent[name].([]interface{})
+	if _, found := parent[name]; found && !ok {
+		return nil, p.errorf("%s is not an array of tables", name)
+	}
+
+	table := map[string]interface{}{}
+	parent[name] = append(tables, table)
+
+	return table, nil
+}
+
+// table returns the table with the names of keys under table, created if
+// missing. The table of an array of tables is its last one.
+func (p *tomlParser) table(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch value := table[key].(type) {
+		case nil:
+			child := map[string]interface{}{}
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = value
+		case []interface{}:
+			var ok bool
+
+			if len(value) > 0 {
+				table, ok = value[len(value)-1].(map[string]interface{})
+			}
+
+			if !ok {
+				return nil, p.errorf("%s is not a table", key)
+			}
+		default:
+			return nil, p.errorf("%s is not a table", key)
+		}
+	}
+
+	return table, nil
+}
+
+// parseKeyValue parses a key and its value into table.
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	p.skipSpace()
+
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+
+	p.pos++
+	p.skipSpace()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	name := keys[len(keys)-1]
+	if _, found := parent[name]; found {
+		return p.errorf("duplicate key %s", name)
+	}
+
+	parent[name] = value
+
+	return nil
+}
+
+// parseKey parses a key, bare, quoted or dotted, and returns its names.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+
+	for {
+		p.skipSpace()
+
+		var key string
+
+		var err error
+
+		switch p.peek() {
+		case '"':
+			key, err = p.parseString(false)
+		case '\'':
+			key, err = p.parseLiteral(false)
+		default:
+			start := p.pos
+
+			for c := p.peek(); c == '_' || c == '-' || isAlphanumeric(c); c = p.peek() {
+				p.pos++
+			}
+
+			if key = p.text[start:p.pos]; key == "" {
+				return nil, p.errorf("expected a key")
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+
+		p.skipSpace()
+
+		if p.peek() != '.' {
+			return keys, nil
+		}
+
+		p.pos++
+	}
+}
+
+// isAlphanumeric reports whether c is an ASCII letter or digit.
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parseValue parses a value: a string, array, inline table, boolean,
+// number or date.
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch p.peek() {
+	case '"':
+		return p.parseString(strings.HasPrefix(p.text[p.pos:], `"""`))
+	case '\'':
+		return p.parseLiteral(strings.HasPrefix(p.text[p.pos:], "'''"))
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+
+	for p.pos < len(p.text) && strings.IndexByte(" \t\n#,]}", p.text[p.pos]) < 0 {
+		p.pos++
+	}
+
+	token := p.text[start:p.pos]
+
+	switch {
+	case token == "true":
+		return true, nil
+	case token == "false":
+		return false, nil
+	case tomlInt.MatchString(token):
+		if n, err := strconv.ParseInt(strings.ReplaceAll(token, "_", ""), 10, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		}
+	case tomlOtherInt.MatchString(token):
+		if n, err := strconv.ParseInt(token, 0, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		}
+	case tomlFloat.MatchString(token):
+		if f, err := strconv.ParseFloat(strings.ReplaceAll(token, "_", ""), 64); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+		}
+	case tomlDate.MatchString(token):
+		return token, nil
+	}
+
+	if token == "" {
+		return nil, p.errorf("missing value")
+	}
+
+	return nil, p.errorf("invalid value, %s", token)
+}
+
+// parseString parses a basic string, multiline if it starts with three
+// quotes, and returns it with its escapes replaced.
+func (p *tomlParser) parseString(multiline bool) (string, error) {
+	var value strings.Builder
+
+	delimiter := `"`
+	if multiline {
+		delimiter = `"""`
+	}
+
+	p.pos += len(delimiter)
+
+	// A newline right after the opening quotes is not part of the string.
+	if multiline && p.peek() == '\n' {
+		p.pos++
+	}
+
+	for {
+		switch c := p.peek(); {
+		case c == 0 || (c == '\n' && !multiline):
+			return "", p.errorf("unterminated string")
+		case strings.HasPrefix(p.text[p.pos:], delimiter):
+			p.pos += len(delimiter)
+
+			// Up to two quotes before the closing ones are in the string.
+			for n := 0; multiline && n < 2 && p.peek() == '"'; n++ {
+				value.WriteByte('"')
+				p.pos++
+			}
+
+			return value.String(), nil
+		case c == '\\':
+			if err := p.parseEscape(&value, multiline); err != nil {
+				return "", err
+			}
+		default:
+			value.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseEscape parses an escape sequence of a basic string into value. In
+// multiline strings, a backslash at the end of a line trims the white space
+// up to the next other character.
+func (p *tomlParser) parseEscape(value *strings.Builder, multiline bool) error {
+	p.pos++
+
+	if rest := strings.TrimLeft(p.text[p.pos:], " \t"); multiline && strings.HasPrefix(rest, "\n") {
+		p.pos = len(p.text) - len(strings.TrimLeft(rest, " \t\n"))
+
+		return nil
+	}
+
+	escapes := map[byte]string{'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", '"': `"`, '\\': `\`}
+
+	c := p.peek()
+	if escape, ok := escapes[c]; ok {
+		value.WriteString(escape)
+		p.pos++
+
+		return nil
+	}
+
+	size := map[byte]int{'u': 4, 'U': 8}[c]
+	if size == 0 || p.pos+1+size > len(p.text) {
+		return p.errorf("invalid escape in string")
+	}
+
+	code, err := strconv.ParseUint(p.text[p.pos+1:p.pos+1+size], 16, 32)
+	if err != nil {
+		return p.errorf("invalid escape in string")
+	}
+
+	value.WriteRune(rune(code))
+	p.pos += 1 + size
+
+	return nil
+}
+
+// parseLiteral parses a literal string, multiline if it starts with three
+// quotes, which has no escapes.
+func (p *tomlParser) parseLiteral(multiline bool) (string, error) {
+	delimiter := "'"
+	if multiline {
+		delimiter = "'''"
+	}
+
+	p.pos += len(delimiter)
+
+	if multiline && p.peek() == '\n' {
+		p.pos++
+	}
+
+	end := strings.Index(p.text[p.pos:], delimiter)
+	if end < 0 || (!multiline && strings.Contains(p.text[p.pos:p.pos+end], "\n")) {
+		return "", p.errorf("unterminated string")
+	}
+
+	// Up to two quotes before the closing ones are in the string.
+	for n := 0; multiline && n < 2 && p.pos+end+3 < len(p.text) && p.text[p.pos+end+3] == '\''; n++ {
+		end++
+	}
+
+	value := p.text[p.pos : p.pos+end]
+	p.pos += end + len(delimiter)
+
+	return value, nil
+}
+
+// parseArray parses an array, over several lines if need be.
+func (p *tomlParser) parseArray() (interface{}, error) {
+	p.pos++
+
+	array := []interface{}{}
+
+	for {
+		p.skipBlank(true)
+
+		if p.peek() == ']' {
+			p.pos++
+
+			return array, nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		array = append(array, value)
+
+		p.skipBlank(true)
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// parseInlineTable parses an inline table, on a single line.
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.pos++
+
+	table := map[string]interface{}{}
+
+	p.skipSpace()
+
+	if p.peek() == '}' {
+		p.pos++
+
+		return table, nil
+	}
+
+	for {
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTOMLToJSONExample(t *testing.T) {
+	const example = `# The same as config.json.example.
+log = "$HOME/.cache/do-dyndns/out.log"
+token = 'dop_v1_deadbeef'
+
+[[records]]
+type = "A"
+subdomain = "foo.example.com"
+
+[[records]]
+type = "A"
+subdomain = "bar.example.com"
+`
+
+	want, err := os.ReadFile("config.json.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tomlToJSON([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameJSON(t, got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTOMLToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		json string
+	}{
+		{
+			name: "values",
+			toml: "a = 1\nb = -2.5\nc = 0x1f\nd = true\ne = 1_000\nf = 1e3\ng = 2024-01-02\n",
+			json: `{"a": 1, "b": -2.5, "c": 31, "d": true, "e": 1000, "f": 1000, "g": "2024-01-02"}`,
+		},
+		{
+			name: "strings",
+			toml: "a = \"tab\\tand \\u00e9\"\nb = 'C:\\path'\nc = \"\"\"\nfirst\nsecond\"\"\"\nd = '''\nraw \\n'''\n",
+			json: `{"a": "tab\tand é", "b": "C:\\path", "c": "first\nsecond", "d": "raw \\n"}`,
+		},
+		{
+			name: "comments",
+			toml: "# heading\na = 1 # trailing\n\n  # indented\nb = \"# kept\"\n",
+			json: `{"a": 1, "b": "# kept"}`,
+		},
+		{
+			name: "quoted keys",
+			toml: "\"a b\" = 1\n'c.d' = 2\n\"e\".f = 3\n",
+			json: `{"a b": 1, "c.d": 2, "e": {"f": 3}}`,
+		},
+		{
+			name: "dotted keys",
+			toml: "timeouts.api = \"30s\"\ntimeouts.detect = \"5s\"\n",
+			json: `{"timeouts": {"api": "30s", "detect": "5s"}}`,
+		},
+		{
+			name: "tables",
+			toml: "token = \"x\"\n\n[vault]\nauth = \"approle\"\n\n[profiles.work]\nttl = 60\n",
+			json: `{"token": "x", "vault": {"auth": "approle"}, "profiles": {"work": {"ttl": 60}}}`,
+		},
+		{
+			name: "quoted table names",
+			toml: "[credentials]\n\"work team\" = \"dop_v1_cafebabe\"\n\n[\"a.b\".c]\nd = 1\n",
+			json: `{"credentials": {"work team": "dop_v1_cafebabe"}, "a.b": {"c": {"d": 1}}}`,
+		},
+		{
+			name: "inline tables",
+			toml: "vault = {auth = \"approle\", role_id = \"id\"}\nempty = {}\nnested = {a = {b = 1}}\n",
+			json: `{"vault": {"auth": "approle", "role_id": "id"}, "empty": {}, "nested": {"a": {"b": 1}}}`,
+		},
+		{
+			name: "arrays",
+			toml: "ip_sources = [\"ipify\", 'icanhazip']\nempty = []\nnested = [[1, 2], []]\n" +
+				"multiline = [\n  1, # one\n  2,\n]\n",
+			json: `{"ip_sources": ["ipify", "icanhazip"], "empty": [], "nested": [[1, 2], []], "multiline": [1, 2]}`,
+		},
+		{
+			name: "arrays of inline tables",
+			toml: "records = [{type = \"A\", subdomain = \"a.example.com\"}, " +
+				"{type = \"AAAA\", subdomain = \"b.example.com\"}]\n",
+			json: `{"records": [{"type": "A", "subdomain": "a.example.com"}, ` +
+				`{"type": "AAAA", "subdomain": "b.example.com"}]}`,
+		},
+		{
+			name: "arrays of tables",
+			toml: "[[records]]\ntype = \"A\"\n\n[records.extra]\nx = 1\n\n[[records]]\ntype = \"AAAA\"\n",
+			json: `{"records": [{"type": "A", "extra": {"x": 1}}, {"type": "AAAA"}]}`,
+		},
+		{
+			name: "arrays of tables in tables",
+			toml: "[profiles.home]\nttl = 60\n\n[[profiles.home.records]]\ntype = \"A\"\n",
+			json: `{"profiles": {"home": {"ttl": 60, "records": [{"type": "A"}]}}}`,
+		},
+		{
+			name: "empty document",
+			toml: "# nothing\n",
+			json: `{}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := tomlToJSON([]byte(test.toml))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !sameJSON(t, got, []byte(test.json)) {
+				t.Errorf("got %s, want %s", got, test.json)
+			}
+		})
+	}
+}
+
+func TestTOMLToJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		err  string
+	}{
+		{name: "duplicate key", toml: "a = 1\na = 2\n", err: "line 2: duplicate key a"},
+		{name: "duplicate table", toml: "[a]\nb = 1\n[a]\nc = 2\n", err: "line 3: duplicate table a"},
+		{name: "missing value", toml: "a =\n", err: "line 1"},
+		{name: "unterminated string", toml: "a = \"text\n", err: "line 1"},
+		{name: "unterminated inline table", toml: "a = {b = 1\n", err: "line 1"},
+		{name: "content after value", toml: "a = 1 2\n", err: "line 1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := tomlToJSON([]byte(test.toml))
+			if err == nil {
+				t.Fatalf("got %s, want an error", got)
+			}
+
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %q, want %q in it", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxTTL is the largest TTL of a record, in seconds, as of RFC 2181.
+const MaxTTL = 1<<31 - 1
+
+// ConfigError is an invalid config, with the problems found in its file,
+// each naming the setting.
+type ConfigError struct {
+	File     string
+	Problems []string
+}
+
+// Error returns the problems of the config.
+func (e *ConfigError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// rawMessageType is the type of settings decoded later, such as profiles.
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// checkConfigFields returns the problems of the fields of the JSON config
+// content: unknown fields, with their path in the config, and values of the
+// wrong type. Profiles are checked as whole configs.
+func checkConfigFields(content []byte) []string {
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return []string{err.Error()}
+	}
+
+	configType := reflect.TypeOf(Config{})
+	problems := checkFields(value, configType, "")
+
+	if config, ok := value.(map[string]interface{}); ok {
+		for key, value := range config {
+			if !strings.EqualFold(key, "profiles") {
+				continue
+			}
+
+			profiles, _ := value.(map[string]interface{})
+
+			for _, name := range sortedKeys(profiles) {
+				problems = append(problems, checkFields(profiles[name], configType, "profiles."+name)...)
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkFields returns the problems found decoding the JSON value, decoded
+// with UseNumber, at path into a value of type t.
+func checkFields(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if value == nil || t == rawMessageType || t.Kind() == reflect.Interface {
+		return nil
+	}
+
+	var problems []string
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{mismatch(path, "an object", value)}
+		}
+
+		fields := jsonFields(t)
+
+		for _, name := range sortedKeys(object) {
+			field, ok := fields[strings.ToLower(name)]
+			if !ok {
+				problems = append(problems, atPath(path, "unknown field, "+name))
+
+				continue
+			}
+
+			problems = append(problems, checkFields(object[name], field, fieldPath(path, name))...)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{mismatch(path, "an object", value)}
+		}
+
+		for _, key := range sortedKeys(object) {
+			problems = append(problems, checkFields(object[key], t.Elem(), fieldPath(path, key))...)
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{mismatch(path, "an array", value)}
+		}
+
+		for i, item := range array {
+			problems = append(problems, checkFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return []string{mismatch(path, "a string", value)}
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return []string{mismatch(path, "true or false", value)}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if number, ok := value.(json.Number); !ok {
+			return []string{mismatch(path, "a number", value)}
+		} else if _, err := number.Int64(); err != nil {
+			return []string{atPath(path, fmt.Sprintf("invalid integer, %s", number))}
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			return []string{mismatch(path, "a number", value)}
+		}
+	}
+
+	return problems
+}
+
+// jsonFields returns the types of the fields of the struct type t by their
+// JSON names in lower case, since JSON names are matched regardless of
+// case, including those of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		switch {
+		case name == "-" || (!field.IsExported() && !field.Anonymous):
+			continue
+		case field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct:
+			for embedded, fieldType := range jsonFields(field.Type) {
+				fields[embedded] = fieldType
+			}
+
+			continue
+		case name == "":
+			name = field.Name
+		}
+
+		fields[strings.ToLower(name)] = field.Type
+	}
+
+	return fields
+}
+
+// sortedKeys returns the keys of object, in order.
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fieldPath returns the path of the field name of the object at path.
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// atPath returns problem, of the setting at path unless it is the whole
+// config.
+func atPath(path, problem string) string {
+	if path == "" {
+		return problem
+	}
+
+	return path + ": " + problem
+}
+
+// mismatch returns the problem of the value at path not being of the kind
+// expected.
+func mismatch(path, expected string, value interface{}) string {
+	var kind string
+
+	switch value.(type) {
+	case string:
+		kind = "a string"
+	case json.Number:
+		kind = "a number"
+	case bool:
+		kind = "true or false"
+	case []interface{}:
+		kind = "an array"
+	default:
+		kind = "an object"
+	}
+
+	return atPath(path, fmt.Sprintf("expected %s, not %s", expected, kind))
+}
+
+// knownType reports whether recordType, in upper case, is a record type
+// that can be configured.
+func knownType(recordType string) bool {
+	return recordType == "A" || recordType == "AAAA" || recordType == "AUTO" || recordType == DualStack ||
+		StaticTypes[recordType]
+}
+
+// validateConfig returns the problems found in config, each naming the
+// setting, instead of stopping at the first like a run does, along with the
+// valid records, their indices in the config and their providers. Parked
+// records are not checked. The config is not changed.
+func validateConfig(config Config) (Providers, []Record, []int, []string) {
+	var problems []string
+
+	if config.Provider == "" {
+		config.Provider = ProviderDigitalOcean
+	}
+
+	// The records are copied, not to change those of the caller, without
+	// the parked ones. indices are their places in the config.
+	records := make([]Record, 0, len(config.Records))
+	indices := make([]int, 0, len(config.Records))
+
+	for i, record := range config.Records {
+		if record.enabled() {
+			records = append(records, config.Defaults.apply(record))
+			indices = append(indices, i)
+		}
+	}
+
+	config.Records = records
+
+	if config.Duplicates != "" && config.Duplicates != DuplicatesWarn && config.Duplicates != DuplicatesUpdate &&
+		config.Duplicates != DuplicatesDelete {
+		problems = append(problems, fmt.Sprintf("duplicates: invalid duplicates policy, %s", config.Duplicates))
+	}
+
+	if config.Prefer != "" && config.Prefer != PreferIPv4 && config.Prefer != PreferIPv6 {
+		problems = append(problems, fmt.Sprintf("prefer: invalid address family preference, %s", config.Prefer))
+	}
+
+	if config.TTL < 0 || config.TTL > MaxTTL {
+		problems = append(problems, fmt.Sprintf("ttl: invalid TTL, %d", config.TTL))
+	}
+
+	if _, err := parseTimeout("api", config.Timeouts.API, APITimeout); err != nil {
+		problems = append(problems, "timeouts.api: "+err.Error())
+	}
+
+	if _, err := parseTimeout("healthcheck", config.Timeouts.Healthcheck, HealthcheckTimeout); err != nil {
+		problems = append(problems, "timeouts.healthcheck: "+err.Error())
+	}
+
+	if _, err := newRetry("api", config.APIRetry); err != nil {
+		problems = append(problems, "api_retry: "+err.Error())
+	}
+
+	if _, err := parseStateMaxAge(config.StateMaxAge); err != nil {
+		problems = append(problems, "state_max_age: "+err.Error())
+	}
+
+	if config.Proxy != "" {
+		if _, err := parseProxy(config.Proxy); err != nil {
+			problems = append(problems, "proxy: "+err.Error())
+		}
+	}
+
+	// Detection checks its own settings, from the timeout to the sources.
+	if _, err := newDetection(&config, nil); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	var (
+		valid        []Record
+		validIndices []int
+	)
+
+	accounts := make([]Record, 0, len(config.Records))
+
+	for i, record := range config.Records {
+		recordProblems := validateRecord(&config, &record)
+
+		for _, problem := range recordProblems {
+			problems = append(problems, fmt.Sprintf("records[%d]: %s", indices[i], problem))
+		}
+
+		if len(recordProblems) == 0 {
+			valid = append(valid, record)
+			validIndices = append(validIndices, indices[i])
+		}
+
+		accounts = append(accounts, record)
+	}
+
+	// Providers check their own settings, such as the token, even for
+	// invalid records.
+	config.Records = accounts
+
+	providers, err := newProviders(&config)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return providers, valid, validIndices, problems
+}
+
+// validateRecord returns the problems found in record, and sets its
+// provider, token and TTL as a run does.
+func validateRecord(config *Config, record *Record) []string {
+	var problems []string
+
+	if record.Provider == "" {
+		record.Provider = config.Provider
+	}
+
+	if record.TTL == 0 {
+		record.TTL = config.TTL
+	}
+
+	recordType := strings.ToUpper(record.Type)
+	if recordType == "" {
+		problems = append(problems, "missing type")
+	} else if !knownType(recordType) {
+		problems = append(problems, fmt.Sprintf("invalid type, %s", record.Type))
+	}
+
+	if record.Subdomain == "" && record.Domain == "" {
+		problems = append(problems, "missing subdomain")
+	} else if _, _, err := record.split(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if StaticTypes[recordType] {
+		if _, err := record.staticData(recordType); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if record.Proxied && record.Provider != ProviderCloudflare {
+		problems = append(problems, fmt.Sprintf("proxied needs the %s provider, not %s", ProviderCloudflare,
+			record.Provider))
+	}
+
+	if record.TTL < 0 || record.TTL > MaxTTL {
+		problems = append(problems, fmt.Sprintf("invalid TTL, %d", record.TTL))
+	}
+
+	if record.IPv6Suffix != "" {
+		if _, err := withSuffix(net.IPv6zero, record.IPv6Suffix, record.PrefixLength); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if record.BindAddress != "" && net.ParseIP(record.BindAddress) == nil {
+		problems = append(problems, fmt.Sprintf("invalid bind address, %s", record.BindAddress))
+	}
+
+	own := 0
+	sources := []bool{record.Interface != "", record.IP != "", record.IPSourceURL != "" || len(record.IPSources) > 0}
+
+	for _, set := range sources {
+		if set {
+			own++
+		}
+	}
+
+	if own > 1 {
+		problems = append(problems, "only one of interface, ip, and ip_source_url or ip_sources can be set")
+	}
+
+	if record.IPSourceField != "" && record.IPSourceURL == "" {
+		problems = append(problems, "ip_source_field needs an ip_source_url")
+	}
+
+	if record.IP != "" {
+		if _, err := newStaticDetector(record.IP); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if record.Credential != "" {
+		token, ok := config.Credentials[record.Credential]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown credential, %s", record.Credential))
+		}
+
+		record.Token = token
+	}
+
+	return problems
+}
+
+// checkDomains asks the providers that can list their domains, within
+// timeout, whether the domains of records are in their accounts, which
+// also checks their credentials. It returns the problems found, naming the
+// records by their indices in the config.
+func checkDomains(providers Providers, records []Record, indices []int, timeout time.Duration) []string {
+	var problems []string
+
+	zones := Zones{}
+	failed := map[Provider]bool{}
+
+	for i, record := range records {
+		provider := providers[record.account()]
+
+		lister, ok := provider.(DomainLister)
+		if !ok || failed[provider] {
+			continue
+		}
+
+		if _, listed := zones[provider]; !listed {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			domains, err := lister.Domains(ctx)
+
+			cancel()
+
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("records[%d]: error listing the domains of %s; %s",
+					indices[i], record.Provider, err))
+				failed[provider] = true
+
+				continue
+			}
+
+			zones[provider] = domains
+		}
+
+		if _, domain := zones.split(provider, record, timeout); !hasDomain(zones[provider], domain) {
+			problems = append(problems, fmt.Sprintf("records[%d]: domain %s not found in the %s account",
+				indices[i], domain, record.Provider))
+		}
+	}
+
+	return problems
+}
+
+// hasDomain reports whether domain is one of domains.
+func hasDomain(domains []string, domain string) bool {
+	for _, other := range domains {
+		if strings.EqualFold(other, domain) {
+			return true
+		}
+	}
+
+	return false
+}
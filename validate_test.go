@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDomainsIndices(t *testing.T) {
+	provider := newTestDigitalOcean(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		_, _ = fmt.Fprint(w, `{"domains":[{"name":"example.com"}],"links":{},"meta":{"total":1}}`)
+	})
+
+	disabled := false
+	config := Config{Token: "dop_v1_deadbeef", Records: []Record{
+		{Type: "A", Subdomain: "parked.example.org", Enabled: &disabled},
+		{Type: "A", Subdomain: "home.example.com"},
+		{Type: "A", Subdomain: "office.example.org"},
+	}}
+
+	_, records, indices, problems := validateConfig(config)
+	if len(problems) > 0 {
+		t.Fatalf("got problems %q, want none", problems)
+	}
+
+	// The parked record is not checked, but keeps its index.
+	if fmt.Sprint(indices) != "[1 2]" {
+		t.Fatalf("got indices %v, want [1 2]", indices)
+	}
+
+	providers := Providers{ProviderDigitalOcean: provider}
+
+	problems = checkDomains(providers, records, indices, time.Second)
+
+	want := "records[2]: domain example.org not found in the digitalocean account"
+	if strings.Join(problems, "; ") != want {
+		t.Errorf("got problems %q, want %q", problems, want)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TokenSourceVault is the "token_source" of a token read from a secret of
+// HashiCorp Vault, as set in the "vault" section.
+const TokenSourceVault = "vault"
+
+// Vault auth methods.
+const (
+	VaultAuthToken      = "token"
+	VaultAuthAppRole    = "approle"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// VaultKubernetesJWTFile is the service account token that logs in Vault
+// with the kubernetes auth method.
+const VaultKubernetesJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token" //nolint:gosec // Not a secret.
+
+// VaultConfig is where in Vault the token is kept, and how to log in.
+type VaultConfig struct {
+	// Address is the URL of the Vault server, or VAULT_ADDR if empty.
+	Address   string `json:"address"`
+	Namespace string `json:"namespace"`
+	// Auth is the auth method, VaultAuthToken by default.
+	Auth string `json:"auth"`
+	// Token is the Vault token of VaultAuthToken, or VAULT_TOKEN or
+	// ~/.vault-token if empty.
+	Token string `json:"token"`
+	// RoleID and SecretID log in with VaultAuthAppRole.
+	RoleID   string `json:"role_id"`
+	SecretID string `json:"secret_id"`
+	// Role logs in with VaultAuthKubernetes.
+	Role string `json:"role"`
+	// Mount is the path of the auth method, the name of the method if empty.
+	Mount string `json:"mount"`
+	// Path is the path of the secret, e.g. "secret/data/do-dyndns" with
+	// KV version 2, and Field the field of the token in it, "token" if
+	// empty.
+	Path  string `json:"path"`
+	Field string `json:"field"`
+}
+
+// vaultAuth is the auth info of Vault responses.
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// Vault reads secrets from a Vault server, logged in as configured, and
+// renews the login as it expires.
+type Vault struct {
+	client *http.Client
+	config VaultConfig
+	// token is the Vault token logged in with, to renew at renewAt, half
+	// its lifetime, unless zero.
+	token     string
+	renewAt   time.Time
+	renewable bool
+}
+
+// newVault returns a Vault for config, not logged in yet.
+func newVault(config VaultConfig) (*Vault, error) {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+
+	if config.Namespace == "" {
+		config.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	if config.Auth == "" {
+		config.Auth = VaultAuthToken
+	}
+
+	if config.Mount == "" {
+		config.Mount = config.Auth
+	}
+
+	if config.Field == "" {
+		config.Field = "token"
+	}
+
+	switch {
+	case config.Address == "":
+		return nil, errors.New("missing Vault address")
+	case config.Path == "":
+		return nil, errors.New("missing Vault secret path")
+	case config.Auth != VaultAuthToken && config.Auth != VaultAuthAppRole && config.Auth != VaultAuthKubernetes:
+		return nil, fmt.Errorf("invalid Vault auth method, %s", config.Auth)
+	}
+
+	config.Address = strings.TrimSuffix(config.Address, "/")
+
+	return &Vault{client: newAPIClient(), config: config}, nil
+}
+
+// request sends a request to the Vault API at path, logged in unless the
+// token is empty.
+func (v *Vault) request(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+
+	if v.token != "" {
+		header.Set("X-Vault-Token", v.token)
+	}
+
+	if v.config.Namespace != "" {
+		header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	return requestJSON(ctx, v.client, method, v.config.Address+"/v1/"+strings.TrimPrefix(path, "/"), header, body, out)
+}
+
+// setAuth keeps the Vault token of auth, and when to renew it.
+func (v *Vault) setAuth(auth vaultAuth) {
+	v.token = auth.ClientToken
+	v.renewable = auth.Renewable
+	v.renewAt = time.Time{}
+
+	if auth.LeaseDuration > 0 {
+		v.renewAt = time.Now().Add(time.Duration(auth.LeaseDuration) * time.Second / 2)
+	}
+}
+
+// login logs in with the configured auth method.
+func (v *Vault) login(ctx context.Context) error {
+	var body map[string]string
+
+	switch v.config.Auth {
+	case VaultAuthAppRole:
+		body = map[string]string{"role_id": v.config.RoleID, "secret_id": v.config.SecretID}
+	case VaultAuthKubernetes:
+		jwt, err := os.ReadFile(VaultKubernetesJWTFile)
+		if err != nil {
+			return err
+		}
+
+		body = map[string]string{"role": v.config.Role, "jwt": strings.TrimSpace(string(jwt))}
+	default:
+		return v.lookupToken(ctx)
+	}
+
+	var response struct {
+		Auth *vaultAuth `json:"auth"`
+	}
+
+	v.token = ""
+
+	if err := v.request(ctx, http.MethodPost, "auth/"+v.config.Mount+"/login", body, &response); err != nil {
+		return fmt.Errorf("error logging in Vault; %w", err)
+	}
+
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return errors.New("no Vault token in the login response")
+	}
+
+	v.setAuth(*response.Auth)
+
+	return nil
+}
+
+// lookupToken logs in with the configured Vault token, checking it and
+// when it expires.
+func (v *Vault) lookupToken(ctx context.Context) error {
+	token := v.config.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if token == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			content, _ := os.ReadFile(filepath.Join(homeDir, ".vault-token"))
+			token = strings.TrimSpace(string(content))
+		}
+	}
+
+	if token == "" {
+		return errors.New("missing Vault token")
+	}
+
+	var response struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+
+	v.token = token
+
+	if err := v.request(ctx, http.MethodGet, "auth/token/lookup-self", nil, &response); err != nil {
+		return fmt.Errorf("error checking the Vault token; %w", err)
+	}
+
+	v.setAuth(vaultAuth{ClientToken: token, LeaseDuration: response.Data.TTL, Renewable: response.Data.Renewable})
+
+	return nil
+}
+
+// renew renews the login if it is renewable, or logs in again.
+func (v *Vault) renew(ctx context.Context) error {
+	if v.renewable {
+		var response struct {
+			Auth *vaultAuth `json:"auth"`
+		}
+
+		err := v.request(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{}, &response)
+		if err == nil && response.Auth != nil && response.Auth.ClientToken != "" {
+			v.setAuth(*response.Auth)
+
+			return nil
+		}
+	}
+
+	return v.login(ctx)
+}
+
+// secret returns the token kept in Vault, logging in first, or renewing
+// the login if it has gone through more than half its lifetime.
+func (v *Vault) secret(ctx context.Context) (string, error) {
+	switch {
+	case v.token == "":
+		if err := v.login(ctx); err != nil {
+			return "", err
+		}
+	case !v.renewAt.IsZero() && time.Now().After(v.renewAt):
+		if err := v.renew(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := v.request(ctx, http.MethodGet, v.config.Path, nil, &response); err != nil {
+		return "", fmt.Errorf("error reading the Vault secret %s; %w", v.config.Path, err)
+	}
+
+	fields := response.Data
+
+	// KV version 2 nests the secret in another data, with its metadata.
+	if data, ok := fields["data"].(map[string]interface{}); ok {
+		if _, ok = fields["metadata"]; ok {
+			fields = data
+		}
+	}
+
+	token, ok := fields[v.config.Field].(string)
+	if !ok || token == "" {
+		return "", fmt.Errorf("no field %s in the Vault secret %s", v.config.Field, v.config.Path)
+	}
+
+	return token, nil
+}
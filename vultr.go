@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// VultrAPI is the base URL of the Vultr API.
+const VultrAPI = "https://api.vultr.com/v2"
+
+// VultrConfig is the "vultr" section of the config file.
+type VultrConfig struct {
+	// Token is a Vultr API key.
+	Token string `json:"token"`
+}
+
+// Vultr is the Vultr DNS provider.
+type Vultr struct {
+	client *http.Client
+	token  string
+}
+
+// vultrMeta is the pagination metadata of Vultr API responses.
+type vultrMeta struct {
+	Meta struct {
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"meta"`
+}
+
+// vultrRecord is a DNS record in the Vultr API.
+type vultrRecord struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+	// Priority is the priority of SRV and MX records, which is not in Data.
+	Priority *int `json:"priority,omitempty"`
+}
+
+// toVultr converts a DNSRecord to a Vultr record.
+func toVultr(record DNSRecord) vultrRecord {
+	converted := vultrRecord{Name: blankApex(record.Name), Data: record.Data, TTL: record.TTL}
+
+	if priority, rest, ok := splitPriority(record.Type, record.Data); ok {
+		converted.Data, converted.Priority = rest, &priority
+	}
+
+	return converted
+}
+
+// newVultr returns a Vultr DNS provider.
+func newVultr(config VultrConfig) (*Vultr, error) {
+	if config.Token == "" {
+		return nil, errors.New("missing Vultr token")
+	}
+
+	return &Vultr{client: newAPIClient(), token: config.Token}, nil
+}
+
+// request sends a request to the Vultr API and decodes the response.
+func (p *Vultr) request(ctx context.Context, method, path string, body, out interface{}) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.token)
+
+	err := requestJSON(ctx, p.client, method, VultrAPI+path, header, body, out)
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w, check that the Vultr API key is valid and allows your IP address", ErrUnauthorized)
+	}
+
+	return err
+}
+
+// vultrRecordsPath returns the API path of the records of domain.
+func vultrRecordsPath(domain string) string {
+	return "/domains/" + url.PathEscape(domain) + "/records"
+}
+
+// Records returns the records in domain with the given type and name.
+func (p *Vultr) Records(ctx context.Context, domain, recordType, name string) ([]DNSRecord, error) {
+	var matches []DNSRecord
+
+	for cursor := ""; ; {
+		var resp struct {
+			vultrMeta
+			Records []vultrRecord `json:"records"`
+		}
+
+		query := "?per_page=500&cursor=" + url.QueryEscape(cursor)
+
+		err := p.request(ctx, http.MethodGet, vultrRecordsPath(domain)+query, nil, &resp)
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w in Vultr account: %s", ErrDomainNotFound, domain)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range resp.Records {
+			if record.Type == recordType && record.Name == blankApex(name) {
+				data := record.Data
+				if NumericFields[recordType] > 0 && record.Priority != nil {
+					data = joinData([]int{*record.Priority}, data)
+				}
+
+				matches = append(matches, DNSRecord{
+					ID:   record.ID,
+					Type: record.Type,
+					Name: name,
+					Data: data,
+					TTL:  record.TTL,
+				})
+			}
+		}
+
+		if cursor = resp.Meta.Links.Next; cursor == "" {
+			return matches, nil
+		}
+	}
+}
+
+// CreateRecord creates a record in domain and returns it as created.
+func (p *Vultr) CreateRecord(ctx context.Context, domain string, record DNSRecord) (DNSRecord, error) {
+	var resp struct {
+		Record vultrRecord `json:"record"`
+	}
+
+	body := toVultr(record)
+	body.Type = record.Type
+
+	if err := p.request(ctx, http.MethodPost, vultrRecordsPath(domain), body, &resp); err != nil {
+		return record, err
+	}
+
+	record.ID = resp.Record.ID
+	record.TTL = resp.Record.TTL
+
+	return record, nil
+}
+
+// UpdateRecord updates an existing record in domain.
+func (p *Vultr) UpdateRecord(ctx context.Context, domain string, record DNSRecord) error {
+	return p.request(ctx, http.MethodPatch, vultrRecordsPath(domain)+"/"+record.ID, toVultr(record), nil)
+}
+
+// DeleteRecord deletes an existing record in domain.
+func (p *Vultr) DeleteRecord(ctx context.Context, domain string, record DNSRecord) error {
+	return p.request(ctx, http.MethodDelete, vultrRecordsPath(domain)+"/"+record.ID, nil, nil)
+}
+
+// Domains returns the names of all the domains in the account.
+func (p *Vultr) Domains(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for cursor := ""; ; {
+		var resp struct {
+			vultrMeta
+			Domains []struct {
+				Domain string `json:"domain"`
+			} `json:"domains"`
+		}
+
+		query := "?per_page=500&cursor=" + url.QueryEscape(cursor)
+
+		if err := p.request(ctx, http.MethodGet, "/domains"+query, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, domain := range resp.Domains {
+			names = append(names, domain.Domain)
+		}
+
+		if cursor = resp.Meta.Links.Next; cursor == "" {
+			return names, nil
+		}
+	}
+}
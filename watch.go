@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// WatchInterval is how often the config file is checked for changes where
+// there is no way to be notified of them.
+const WatchInterval = 2 * time.Second
+
+// fileState is what tells that a watched file changed: which file it is,
+// behind any symbolic link, its size and its modification time.
+type fileState struct {
+	info os.FileInfo
+}
+
+// statFile returns the state of file, or an empty state if it is missing,
+// e.g. while an editor replaces it.
+func statFile(file string) fileState {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{info: info}
+}
+
+// changed returns true if the file has changed since the state s, and is
+// there to be read.
+func (s fileState) changed(current fileState) bool {
+	switch {
+	case current.info == nil:
+		return false
+	case s.info == nil:
+		return true
+	}
+
+	return !os.SameFile(s.info, current.info) || s.info.Size() != current.info.Size() ||
+		!s.info.ModTime().Equal(current.info.ModTime())
+}
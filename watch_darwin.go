@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+)
+
+// watchFile returns a channel that receives when file changes, as told by
+// checking it every WatchInterval. Changes to it while one is being handled
+// are received once.
+func watchFile(file string) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+	state := statFile(file)
+
+	go func() {
+		for range time.Tick(WatchInterval) {
+			if current := statFile(file); state.changed(current) {
+				state = current
+
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchFile returns a channel that receives when file changes, as told by
+// inotify. The directory of the file is watched, so that the file is still
+// watched when an editor replaces it, and changes to it while one is being
+// handled are received once.
+func watchFile(file string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE | unix.IN_ATTRIB)
+	if _, err = unix.InotifyAddWatch(fd, filepath.Dir(file), mask); err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	state := statFile(file)
+
+	go func() {
+		events := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+		for {
+			if _, readErr := unix.Read(fd, events); errors.Is(readErr, unix.EINTR) {
+				continue
+			} else if readErr != nil {
+				return
+			}
+
+			// Any file of the directory may have changed; only the state
+			// of the file tells whether it did.
+			if current := statFile(file); state.changed(current) {
+				state = current
+
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
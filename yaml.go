@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// YAML scalars resolved to numbers, as in the YAML 1.2 core schema.
+var (
+	yamlInt      = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlOtherInt = regexp.MustCompile(`^(0o[0-7]+|0x[0-9a-fA-F]+)$`)
+	yamlFloat    = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// yamlLine is a line of a YAML document, without its indentation and
+// comment.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser parses the block mappings and sequences of a YAML document,
+// one line at a time.
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+// yamlToJSON converts a YAML document to JSON, so that config files in YAML
+// are read with the same settings. Only the YAML used by config files is
+// supported: block and flow mappings and sequences, and plain and quoted
+// scalars. Anchors, tags, block scalars and multiple documents are not.
+func yamlToJSON(content []byte) ([]byte, error) {
+	lines, err := yamlLines(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return []byte("null"), nil
+	}
+
+	p := &yamlParser{lines: lines}
+
+	value, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.next < len(p.lines) {
+		return nil, yamlError(p.lines[p.next], "unexpected content")
+	}
+
+	return json.Marshal(value)
+}
+
+// yamlLines returns the lines of a YAML document with some content, up to
+// its end if marked.
+func yamlLines(content string) ([]yamlLine, error) {
+	var lines []yamlLine
+
+	for i, raw := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+
+		if trimmed == "" {
+			continue
+		}
+
+		line := yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed}
+
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, yamlError(line, "tabs are not allowed for indentation")
+		}
+
+		if line.indent == 0 {
+			switch {
+			case text == "...":
+				return lines, nil
+			case text == "---" || strings.HasPrefix(text, "%"):
+				if len(lines) > 0 {
+					return nil, yamlError(line, "multiple documents are not supported")
+				}
+
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// stripYAMLComment returns line without its comment, if any.
+func stripYAMLComment(line string) string {
+	quote := byte(0)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// yamlError returns an error at line of a YAML document.
+func yamlError(line yamlLine, format string, args ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %s", line.number, fmt.Sprintf(format, args...))
+}
+
+// parseNode parses the node that starts at the next line: a mapping, a
+// sequence or a scalar.
+func (p *yamlParser) parseNode() (interface{}, error) {
+	line := p.lines[p.next]
+
+	if isYAMLItem(line.text) {
+		return p.parseSequence(line.indent)
+	}
+
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.parseMapping(line.indent)
+	}
+
+	p.next++
+
+	return parseYAMLInline(line, line.text)
+}
+
+// parseMapping parses a block mapping with its keys at indent.
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := map[string]interface{}{}
+
+	for p.next < len(p.lines) {
+		line := p.lines[p.next]
+		if line.indent < indent {
+			break
+		} else if line.indent > indent {
+			return nil, yamlError(line, "unexpected indentation")
+		}
+
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, yamlError(line, "expected a key")
+		}
+
+		name, err := yamlKey(key)
+		if err != nil {
+			return nil, yamlError(line, "%s", err)
+		}
+
+		if _, found := mapping[name]; found {
+			return nil, yamlError(line, "duplicate key %s", name)
+		}
+
+		p.next++
+
+		var value interface{}
+
+		// The value is on the line of its key, or on the next lines,
+		// indented, or at the same indentation for sequences.
+		switch {
+		case rest != "":
+			value, err = parseYAMLInline(line, rest)
+		case p.next < len(p.lines) && p.lines[p.next].indent > indent:
+			value, err = p.parseNode()
+		case p.next < len(p.lines) && p.lines[p.next].indent == indent && isYAMLItem(p.lines[p.next].text):
+			value, err = p.parseSequence(indent)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping[name] = value
+	}
+
+	return mapping, nil
+}
+
+// parseSequence parses a block sequence with its dashes at indent.
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	sequence := []interface{}{}
+
+	for p.next < len(p.lines) {
+		line := p.lines[p.next]
+		if line.indent < indent || (line.indent == indent && !isYAMLItem(line.text)) {
+			break
+		} else if line.indent > indent {
+			return nil, yamlError(line, "unexpected indentation")
+		}
+
+		var item interface{}
+
+		var err error
+
+		if rest := strings.TrimLeft(line.text[1:], " "); rest != "" {
+			// The item starts on the line of its dash, as if indented by it.
+			p.lines[p.next] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.parseNode()
+		} else {
+			p.next++
+
+			if p.next < len(p.lines) && p.lines[p.next].indent > indent {
+				item, err = p.parseNode()
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		sequence = append(sequence, item)
+	}
+
+	return sequence, nil
+}
+
+// isYAMLItem reports whether text is an item of a block sequence.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits text into the key of a block mapping and the rest of
+// the line, if it has one.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+
+	quote := byte(0)
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case i == 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// yamlKey returns the name of the key of a mapping, unquoted.
+func yamlKey(key string) (string, error) {
+	if key == "" || (key[0] != '"' && key[0] != '\'') {
+		return key, nil
+	}
+
+	value, err := yamlScalar(key)
+	if err != nil {
+		return "", err
+	}
+
+	name, _ := value.(string)
+
+	return name, nil
+}
+
+// parseYAMLInline parses a node written on a single line of a YAML
+// document: a flow mapping or sequence, or a scalar.
+func parseYAMLInline(line yamlLine, text string) (interface{}, error) {
+	var value interface{}
+
+	var err error
+
+	switch text[0] {
+	case '[', '{':
+		flow := &yamlFlow{text: text}
+		if value, err = flow.parse(); err == nil && flow.skipSpace() < len(text) {
+			err = errors.New("unexpected content after flow collection")
+		}
+	case '&', '*', '!':
+		err = errors.New("anchors, aliases and tags are not supported")
+	case '|', '>':
+		err = errors.New("block scalars are not supported")
+	default:
+		value, err = yamlScalar(text)
+	}
+
+	if err != nil {
+		return nil, yamlError(line, "%s", err)
+	}
+
+	return value, nil
+}
+
+// yamlScalar returns the value of a scalar: a string if quoted, or else a
+// null, boolean, number or string.
+func yamlScalar(text string) (interface{}, error) {
+	if text == "" || (text[0] != '"' && text[0] != '\'') {
+		return plainYAMLScalar(text), nil
+	}
+
+	if len(text) < 2 || text[len(text)-1] != text[0] {
+		return nil, fmt.Errorf("invalid quoted scalar, %s", text)
+	}
+
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+
+	value, err := strconv.Unquote(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quoted scalar, %s", text)
+	}
+
+	return value, nil
+}
+
+// plainYAMLScalar returns the value of an unquoted scalar. Numbers are
+// returned as JSON numbers, as written in JSON.
+func plainYAMLScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	switch {
+	case yamlInt.MatchString(text):
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10))
+		}
+	case yamlOtherInt.MatchString(text):
+		if n, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10))
+		}
+	case yamlFloat.MatchString(text):
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	}
+
+	return text
+}
+
+// yamlFlow parses a flow mapping or sequence, as in JSON.
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+// skipSpace skips white space, and returns the position after it.
+func (f *yamlFlow) skipSpace() int {
+	for f.pos < len(f.text) && (f.text[f.pos] == ' ' || f.text[f.pos] == '\t') {
+		f.pos++
+	}
+
+	return f.pos
+}
+
+// peek returns the next character after white space, or 0 at the end.
+func (f *yamlFlow) peek() byte {
+	if f.skipSpace() == len(f.text) {
+		return 0
+	}
+
+	return f.text[f.pos]
+}
+
+// parse parses the next node: a flow mapping or sequence, or a scalar.
+func (f *yamlFlow) parse() (interface{}, error) {
+	switch f.peek() {
+	case '[':
+		f.pos++
+
+		sequence := []interface{}{}
+
+		for f.peek() != ']' {
+			item, err := f.parse()
+			if err != nil {
+				return nil, err
+			}
+
+			sequence = append(sequence, item)
+
+			if err = f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+
+		f.pos++
+
+		return sequence, nil
+	case '{':
+		f.pos++
+
+		mapping := map[string]interface{}{}
+
+		for f.peek() != '}' {
+			if f.peek() == 0 {
+				return nil, errors.New("unterminated flow collection")
+			}
+
+			name, err := yamlKey(f.scalarText())
+			if err != nil {
+				return nil, err
+			}
+
+			if f.peek() != ':' {
+				return nil, fmt.Errorf("missing value of key %s", name)
+			}
+
+			f.pos++
+
+			if mapping[name], err = f.parse(); err != nil {
+				return nil, err
+			}
+
+			if err = f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+
+		f.pos++
+
+		return mapping, nil
+	case 0:
+		return nil, errors.New("unterminated flow collection")
+	}
+
+	return yamlScalar(f.scalarText())
+}
+
+// separator skips the comma after an item of a collection closed by end,
+// unless the collection ends there.
+func (f *yamlFlow) separator(end byte) error {
+	switch f.peek() {
+	case ',':
+		f.pos++
+	case end:
+	case 0:
+		return errors.New("unterminated flow collection")
+	default:
+		return fmt.Errorf("expected , or %c in flow collection", end)
+	}
+
+	return nil
+}
+
+// scalarText returns the text of the next scalar, quotes included.
+func (f *yamlFlow) scalarText() string {
+	start := f.skipSpace()
+
+	if start < len(f.text) && (f.text[start] == '"' || f.text[start] == '\'') {
+		quote := f.text[start]
+
+		for f.pos++; f.pos < len(f.text); f.pos++ {
+			if (quote == '"' && f.text[f.pos] == '\\') ||
+				(quote == '\'' && strings.HasPrefix(f.text[f.pos:], "''")) {
+				f.pos++
+			} else if f.text[f.pos] == quote {
+				f.pos++
+
+				break
+			}
+		}
+
+		return f.text[start:f.pos]
+	}
+
+	for ; f.pos < len(f.text); f.pos++ {
+		c := f.text[f.pos]
+		if c == ',' || c == ']' || c == '}' ||
+			(c == ':' && (f.pos+1 == len(f.text) || strings.IndexByte(" ,]}", f.text[f.pos+1]) >= 0)) {
+			break
+		}
+	}
+
+	return strings.TrimSpace(f.text[start:f.pos])
+}
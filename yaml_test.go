@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sameJSON reports whether the JSON documents got and want have the same
+// values.
+func sameJSON(t *testing.T, got, want []byte) bool {
+	t.Helper()
+
+	var gotValue, wantValue interface{}
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s; %s", got, err)
+	}
+
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		t.Fatalf("invalid JSON %s; %s", want, err)
+	}
+
+	return reflect.DeepEqual(gotValue, wantValue)
+}
+
+func TestYAMLToJSONExample(t *testing.T) {
+	const example = `# The same as config.json.example.
+log: $HOME/.cache/do-dyndns/out.log
+token: "dop_v1_deadbeef"
+records:
+  - type: A
+    subdomain: foo.example.com
+  - type: A
+    subdomain: bar.example.com
+`
+
+	want, err := os.ReadFile("config.json.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := yamlToJSON([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameJSON(t, got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		json string
+	}{
+		{
+			name: "scalars",
+			yaml: "a: 1\nb: -2.5\nc: 0x1f\nd: true\ne: ~\nf: null\ng: text with spaces\nh: 1e3\n",
+			json: `{"a": 1, "b": -2.5, "c": 31, "d": true, "e": null, "f": null, "g": "text with spaces", "h": 1000}`,
+		},
+		{
+			name: "quoted scalars",
+			yaml: "a: \"1\"\nb: 'it''s'\nc: \"tab\\tand # not a comment\"\nd: 'true'\ne: \"\"\n",
+			json: `{"a": "1", "b": "it's", "c": "tab\tand # not a comment", "d": "true", "e": ""}`,
+		},
+		{
+			name: "quoted keys",
+			yaml: "\"a b\": 1\n'c: d': 2\n",
+			json: `{"a b": 1, "c: d": 2}`,
+		},
+		{
+			name: "comments",
+			yaml: "# heading\na: 1 # trailing\n\n  # indented\nb: x#y\nc: '# kept'\n",
+			json: `{"a": 1, "b": "x#y", "c": "# kept"}`,
+		},
+		{
+			name: "nested mappings",
+			yaml: "timeouts:\n  api: 30s\n  detect: 5s\nvault:\n  auth: approle\n",
+			json: `{"timeouts": {"api": "30s", "detect": "5s"}, "vault": {"auth": "approle"}}`,
+		},
+		{
+			name: "block sequences",
+			yaml: "ip_sources:\n  - ipify\n  - icanhazip\nrecords:\n- type: A\n  subdomain: a.example.com\n",
+			json: `{"ip_sources": ["ipify", "icanhazip"], "records": [{"type": "A", "subdomain": "a.example.com"}]}`,
+		},
+		{
+			name: "nested sequences",
+			yaml: "a:\n  - - 1\n    - 2\n  - []\n",
+			json: `{"a": [[1, 2], []]}`,
+		},
+		{
+			name: "flow sequences",
+			yaml: "a: [1, two, \"three, four\", [5]]\nb: []\n",
+			json: `{"a": [1, "two", "three, four", [5]], "b": []}`,
+		},
+		{
+			name: "flow mappings",
+			yaml: "records: [{type: A, subdomain: a.example.com}, {type: AAAA, 'subdomain': \"b.example.com\"}]\n",
+			json: `{"records": [{"type": "A", "subdomain": "a.example.com"}, ` +
+				`{"type": "AAAA", "subdomain": "b.example.com"}]}`,
+		},
+		{
+			name: "empty values",
+			yaml: "a:\nb: {}\n",
+			json: `{"a": null, "b": {}}`,
+		},
+		{
+			name: "document markers",
+			yaml: "---\na: 1\n...\nignored: after the end\n",
+			json: `{"a": 1}`,
+		},
+		{
+			name: "empty document",
+			yaml: "# nothing\n",
+			json: `null`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(test.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !sameJSON(t, got, []byte(test.json)) {
+				t.Errorf("got %s, want %s", got, test.json)
+			}
+		})
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{name: "literal block scalar", yaml: "token: |\n  dop_v1_deadbeef\n", err: "block scalars are not supported"},
+		{name: "folded block scalar", yaml: "token: >\n  dop_v1_deadbeef\n", err: "block scalars are not supported"},
+		{name: "anchor", yaml: "a: &x 1\n", err: "anchors, aliases and tags are not supported"},
+		{name: "unterminated quote", yaml: "a: \"text\n", err: "invalid quoted scalar"},
+		{name: "unterminated flow sequence", yaml: "a: [1, 2\n", err: "line 1: unterminated flow collection"},
+		{name: "tab indentation", yaml: "a:\n\tb: 1\n", err: "line 2: tabs are not allowed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(test.yaml))
+			if err == nil {
+				t.Fatalf("got %s, want an error", got)
+			}
+
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %q, want %q in it", err, test.err)
+			}
+		})
+	}
+}